@@ -0,0 +1,344 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrUnknownArchive is returned when a turn archive is not a .zip, .tar, .tar.gz, or .tgz file.
+var ErrUnknownArchive = errors.New("unknown archive type")
+
+// ErrArchiveTooLarge is returned when a file in a turn archive, or all of the files
+// together, are larger than the archive limits.
+var ErrArchiveTooLarge = errors.New("archive too large")
+
+// The limits on the uncompressed size of the files read from a turn archive.
+// Archives are read into memory, so these keep a small, highly compressed
+// archive from using all of it. They are variables only so the tests can lower them.
+var (
+	maxArchiveFileSize int64 = 64 << 20  // any one file
+	maxArchiveSize     int64 = 512 << 20 // all of the files
+)
+
+// OpenDataFS returns a file system for the data files at the given path.
+// The path may be a directory or a turn archive.
+func OpenDataFS(dataPath string) (fs.FS, error) {
+	fi, err := os.Stat(dataPath)
+	if err != nil {
+		return nil, err
+	} else if fi.IsDir() {
+		return os.DirFS(dataPath), nil
+	}
+	return OpenArchive(dataPath)
+}
+
+// IsArchive returns true if the name has the extension of a turn archive.
+func IsArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenArchive reads a .zip, .tar, .tar.gz, or .tgz turn archive into memory and returns it as a file system.
+func OpenArchive(name string) (fs.FS, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var fsys fs.FS
+	switch lc := strings.ToLower(name); {
+	case strings.HasSuffix(lc, ".zip"):
+		fsys, err = ReadZip(bytes.NewReader(b), int64(len(b)))
+	case strings.HasSuffix(lc, ".tar"):
+		fsys, err = ReadTar(bytes.NewReader(b))
+	case strings.HasSuffix(lc, ".tar.gz"), strings.HasSuffix(lc, ".tgz"):
+		fsys, err = ReadTarGz(bytes.NewReader(b))
+	default:
+		err = ErrUnknownArchive
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return fsys, nil
+}
+
+// ReadZip reads the zip archive into memory and returns it as a file system.
+// If the data files are in a single directory in the archive, that directory is the root of the file system.
+func ReadZip(r io.ReaderAt, size int64) (fs.FS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	fsys, size := newMemFS(), int64(0)
+	for _, zf := range zr.File {
+		name, ok := archiveName(zf.Name)
+		if !ok {
+			continue
+		}
+		if zf.FileInfo().IsDir() {
+			if _, err := fsys.mkdir(name, zf.Modified); err != nil {
+				return nil, err
+			}
+			continue
+		} else if !zf.Mode().IsRegular() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := readArchiveFile(rc, name, &size)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err := fsys.add(&memFile{name: name, data: data, mode: zf.Mode().Perm(), modTime: zf.Modified}); err != nil {
+			return nil, err
+		}
+	}
+	return archiveRoot(fsys)
+}
+
+// ReadTar reads the tar archive into memory and returns it as a file system.
+// If the data files are in a single directory in the archive, that directory is the root of the file system.
+func ReadTar(r io.Reader) (fs.FS, error) {
+	fsys, size := newMemFS(), int64(0)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		name, ok := archiveName(hdr.Name)
+		if !ok {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if _, err := fsys.mkdir(name, hdr.ModTime); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			data, err := readArchiveFile(tr, name, &size)
+			if err != nil {
+				return nil, err
+			}
+			if err := fsys.add(&memFile{name: name, data: data, mode: fs.FileMode(hdr.Mode).Perm(), modTime: hdr.ModTime}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return archiveRoot(fsys)
+}
+
+// readArchiveFile reads a file from an archive and adds its length to size.
+// It is an error if the file is larger than maxArchiveFileSize or if it
+// takes size over maxArchiveSize.
+func readArchiveFile(r io.Reader, name string, size *int64) ([]byte, error) {
+	limit := maxArchiveFileSize
+	if left := maxArchiveSize - *size; left < limit {
+		limit = left
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s: %w", name, ErrArchiveTooLarge)
+	}
+	*size += int64(len(data))
+	return data, nil
+}
+
+// archiveName returns the name of an archive entry in the file system.
+// Entries outside the archive, such as ../galaxy.dat or /galaxy.dat, are not valid.
+func archiveName(name string) (string, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	return name, fs.ValidPath(name) && name != "."
+}
+
+// ReadTarGz reads the gzipped tar archive into memory and returns it as a file system.
+// If the data files are in a single directory in the archive, that directory is the root of the file system.
+func ReadTarGz(r io.Reader) (fs.FS, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ReadTar(zr)
+}
+
+// archiveRoot returns the directory in the archive that holds galaxy.dat.
+// That is either the root of the archive or the only directory in the root.
+func archiveRoot(fsys fs.FS) (fs.FS, error) {
+	if _, err := fs.Stat(fsys, "galaxy.dat"); err == nil {
+		return fsys, nil
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		if _, err := fs.Stat(fsys, path.Join(entries[0].Name(), "galaxy.dat")); err == nil {
+			return fs.Sub(fsys, entries[0].Name())
+		}
+	}
+	return fsys, nil
+}
+
+// memFS is a read-only, in-memory file system.
+type memFS struct {
+	files map[string]*memFile
+}
+
+func newMemFS() *memFS {
+	fsys := &memFS{files: make(map[string]*memFile)}
+	fsys.files["."] = &memFile{name: ".", mode: fs.ModeDir | 0555}
+	return fsys
+}
+
+// add adds the file and any missing parent directories.
+// Adding a file that is already there keeps the first one; adding a file
+// where there is a directory, or the other way around, is an error.
+func (fsys *memFS) add(f *memFile) error {
+	if old, ok := fsys.files[f.name]; ok {
+		if old.IsDir() != f.IsDir() {
+			return &fs.PathError{Op: "add", Path: f.name, Err: fs.ErrExist}
+		}
+		return nil
+	}
+	parent, err := fsys.mkdir(path.Dir(f.name), f.modTime)
+	if err != nil {
+		return err
+	}
+	parent.children = append(parent.children, f)
+	sort.Slice(parent.children, func(i, j int) bool {
+		return parent.children[i].name < parent.children[j].name
+	})
+	fsys.files[f.name] = f
+	return nil
+}
+
+// mkdir returns the named directory, creating it and any missing parents.
+// It is an error if a file that is not a directory has the name.
+func (fsys *memFS) mkdir(name string, modTime time.Time) (*memFile, error) {
+	if dir, ok := fsys.files[name]; ok {
+		if !dir.IsDir() {
+			return nil, &fs.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}
+		}
+		return dir, nil
+	}
+	dir := &memFile{name: name, mode: fs.ModeDir | 0555, modTime: modTime}
+	if err := fsys.add(dir); err != nil {
+		return nil, err
+	}
+	return dir, nil
+}
+
+func (fsys *memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, ok := fsys.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	} else if f.IsDir() {
+		return &memDir{memFile: f}, nil
+	}
+	return &memOpenFile{memFile: f, r: bytes.NewReader(f.data)}, nil
+}
+
+// memFile is a file or directory in a memFS.
+// It implements both fs.FileInfo and fs.DirEntry.
+type memFile struct {
+	name     string
+	data     []byte
+	mode     fs.FileMode
+	modTime  time.Time
+	children []*memFile
+}
+
+func (f *memFile) Info() (fs.FileInfo, error) { return f, nil }
+func (f *memFile) IsDir() bool                { return f.mode.IsDir() }
+func (f *memFile) ModTime() time.Time         { return f.modTime }
+func (f *memFile) Mode() fs.FileMode          { return f.mode }
+func (f *memFile) Name() string               { return path.Base(f.name) }
+func (f *memFile) Size() int64                { return int64(len(f.data)) }
+func (f *memFile) Sys() interface{}           { return nil }
+func (f *memFile) Type() fs.FileMode          { return f.mode.Type() }
+
+// memOpenFile is an open file in a memFS.
+type memOpenFile struct {
+	*memFile
+	r *bytes.Reader
+}
+
+func (f *memOpenFile) Close() error                                 { return nil }
+func (f *memOpenFile) Read(b []byte) (int, error)                   { return f.r.Read(b) }
+func (f *memOpenFile) ReadAt(b []byte, off int64) (int, error)      { return f.r.ReadAt(b, off) }
+func (f *memOpenFile) Seek(offset int64, whence int) (int64, error) { return f.r.Seek(offset, whence) }
+func (f *memOpenFile) Stat() (fs.FileInfo, error)                   { return f.memFile, nil }
+
+// memDir is an open directory in a memFS.
+type memDir struct {
+	*memFile
+	offset int
+}
+
+func (d *memDir) Close() error               { return nil }
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.memFile, nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	for ; d.offset < len(d.children) && (n <= 0 || len(entries) < n); d.offset++ {
+		entries = append(entries, d.children[d.offset])
+	}
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	return entries, nil
+}
@@ -0,0 +1,257 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// archiveEntry is a file or, if the name ends in a slash, a directory in a test archive.
+type archiveEntry struct {
+	name string
+	data []byte
+}
+
+// turnEntries returns the files that writeTestFiles writes, named with the prefix.
+func turnEntries(t *testing.T, prefix string) []archiveEntry {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestFiles(t, dir, NewLayout(binary.LittleEndian), 27)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []archiveEntry
+	for _, fi := range infos {
+		data, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, archiveEntry{name: prefix + fi.Name(), data: data})
+	}
+	return entries
+}
+
+func makeZip(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: time.Unix(1_700_000_000, 0)})
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err := w.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func makeTar(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(e.data)), ModTime: time.Unix(1_700_000_000, 0)}
+		if strings.HasSuffix(e.name, "/") {
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		} else if _, err := tw.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func makeTarGz(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(makeTar(t, entries)); err != nil {
+		t.Fatal(err)
+	} else if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// archiveFormats reads test archives of each format.
+var archiveFormats = []struct {
+	name string
+	read func(t *testing.T, entries []archiveEntry) (fs.FS, error)
+}{
+	{"zip", func(t *testing.T, entries []archiveEntry) (fs.FS, error) {
+		b := makeZip(t, entries)
+		return ReadZip(bytes.NewReader(b), int64(len(b)))
+	}},
+	{"tar", func(t *testing.T, entries []archiveEntry) (fs.FS, error) {
+		return ReadTar(bytes.NewReader(makeTar(t, entries)))
+	}},
+	{"tar.gz", func(t *testing.T, entries []archiveEntry) (fs.FS, error) {
+		return ReadTarGz(bytes.NewReader(makeTarGz(t, entries)))
+	}},
+}
+
+func TestReadArchives(t *testing.T) {
+	evil := archiveEntry{name: "../galaxy.dat", data: []byte("not a galaxy")}
+	for _, tc := range []struct {
+		name    string
+		entries func(t *testing.T) []archiveEntry
+	}{
+		{"root", func(t *testing.T) []archiveEntry { return turnEntries(t, "") }},
+		{"directory", func(t *testing.T) []archiveEntry {
+			return append([]archiveEntry{{name: "turn27/"}}, turnEntries(t, "turn27/")...)
+		}},
+		{"directory without entry", func(t *testing.T) []archiveEntry { return turnEntries(t, "turn27/") }},
+		{"dot slash", func(t *testing.T) []archiveEntry { return turnEntries(t, "./") }},
+		{"dot slash directory", func(t *testing.T) []archiveEntry {
+			return append([]archiveEntry{{name: "./turn27/"}}, turnEntries(t, "./turn27/")...)
+		}},
+		{"dot dot skipped", func(t *testing.T) []archiveEntry { return append([]archiveEntry{evil}, turnEntries(t, "")...) }},
+		{"dot dot skipped in directory", func(t *testing.T) []archiveEntry {
+			return append(turnEntries(t, "turn27/"), evil, archiveEntry{name: "turn27/../../stars.dat", data: []byte("not stars")})
+		}},
+	} {
+		for _, format := range archiveFormats {
+			t.Run(format.name+"/"+tc.name, func(t *testing.T) {
+				fsys, err := format.read(t, tc.entries(t))
+				if err != nil {
+					t.Fatal(err)
+				}
+				cluster, layout, err := LoadFromFSAuto(fsys)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if layout.ByteOrder != binary.LittleEndian {
+					t.Errorf("byte order: want LittleEndian: got %s", layout.ByteOrder)
+				}
+				if cluster.Turn != 27 || len(cluster.Systems) != 3 || len(cluster.Planets) != 4 || len(cluster.Species) != 2 {
+					t.Errorf("want turn 27 with 3 systems, 4 planets and 2 species: got turn %d with %d, %d and %d",
+						cluster.Turn, len(cluster.Systems), len(cluster.Planets), len(cluster.Species))
+				}
+			})
+		}
+	}
+}
+
+func TestReadArchiveFS(t *testing.T) {
+	names := func(prefix string) []string {
+		var names []string
+		for _, name := range []string{"galaxy.dat", "planets.dat", "sp01.dat", "sp02.dat", "stars.dat"} {
+			names = append(names, prefix+name)
+		}
+		return names
+	}
+	for _, format := range archiveFormats {
+		t.Run(format.name, func(t *testing.T) {
+			// a root that is not a turn leaves the whole archive as the file system
+			entries := append(turnEntries(t, "a/"), turnEntries(t, "b/c/")...)
+			entries = append(entries, archiveEntry{name: "b/"}, archiveEntry{name: "readme.txt", data: []byte("two turns")})
+			fsys, err := format.read(t, entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := append(append(names("a/"), names("b/c/")...), "readme.txt")
+			sort.Strings(expected)
+			if err := fstest.TestFS(fsys, expected...); err != nil {
+				t.Error(err)
+			}
+
+			// the only directory in the root becomes the root
+			fsys, err = format.read(t, turnEntries(t, "turn27/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fstest.TestFS(fsys, names("")...); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestReadArchiveConflicts(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		entries []archiveEntry
+	}{
+		{"file then child", []archiveEntry{{name: "a", data: []byte("file")}, {name: "a/b", data: []byte("child")}}},
+		{"file then directory", []archiveEntry{{name: "a", data: []byte("file")}, {name: "a/"}}},
+		{"child then file", []archiveEntry{{name: "a/b", data: []byte("child")}, {name: "a", data: []byte("file")}}},
+	} {
+		for _, format := range archiveFormats {
+			t.Run(format.name+"/"+tc.name, func(t *testing.T) {
+				if _, err := format.read(t, tc.entries); err == nil {
+					t.Errorf("want error: got nil")
+				}
+			})
+		}
+	}
+}
+
+func TestReadArchiveLimits(t *testing.T) {
+	defer func(file, total int64) { maxArchiveFileSize, maxArchiveSize = file, total }(maxArchiveFileSize, maxArchiveSize)
+	maxArchiveFileSize, maxArchiveSize = 1000, 2500
+	zeros := func(n int) []byte { return make([]byte, n) }
+	for _, tc := range []struct {
+		name    string
+		entries []archiveEntry
+		ok      bool
+	}{
+		{"at the limits", []archiveEntry{{name: "a", data: zeros(1000)}, {name: "b", data: zeros(1000)}, {name: "c", data: zeros(500)}}, true},
+		{"file too large", []archiveEntry{{name: "a", data: zeros(1001)}}, false},
+		{"archive too large", []archiveEntry{{name: "a", data: zeros(1000)}, {name: "b", data: zeros(1000)}, {name: "c", data: zeros(501)}}, false},
+	} {
+		for _, format := range archiveFormats {
+			t.Run(format.name+"/"+tc.name, func(t *testing.T) {
+				_, err := format.read(t, tc.entries)
+				if tc.ok && err != nil {
+					t.Errorf("want nil: got %v", err)
+				} else if !tc.ok && !errors.Is(err, ErrArchiveTooLarge) {
+					t.Errorf("want %v: got %v", ErrArchiveTooLarge, err)
+				}
+			})
+		}
+	}
+}
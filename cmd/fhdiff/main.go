@@ -0,0 +1,73 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+// Command fhdiff reports the changes between two turns.
+//
+//	fhdiff [-json] old-turn new-turn
+//
+// Each turn is a directory or turn archive holding the data files.
+package main
+
+import (
+	"flag"
+	"github.com/mdhender/fhdata"
+	"github.com/mdhender/fhdata/diff"
+	"log"
+	"os"
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "write the report as JSON")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		log.Fatal("usage: fhdiff [-json] old-turn new-turn")
+	}
+
+	from, err := load(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	to, err := load(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report := diff.Compare(from, to)
+	if *asJSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func load(dataPath string) (*fhdata.Cluster, error) {
+	fsys, err := fhdata.OpenDataFS(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	cluster, _, err := fhdata.LoadFromFSAuto(fsys)
+	return cluster, err
+}
@@ -0,0 +1,215 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/mdhender/fhdata"
+	"github.com/mdhender/fhdata/internal/way"
+	"log"
+	"net/http"
+)
+
+// the api handlers return the cluster as JSON.
+// they never render the domain types directly; see dto.go.
+
+func (s *Server) apiGetPlanet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetPlanet: %s %s\n", r.Method, r.URL.Path)
+		planet, ok := s.apiPlanet(r)
+		if !ok {
+			apiError(w, http.StatusNotFound)
+			return
+		}
+		s.writeJSON(w, r, newPlanetDTO(planet))
+	}
+}
+
+func (s *Server) apiGetPlanets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetPlanets: %s %s\n", r.Method, r.URL.Path)
+		dtos := []planetDTO{}
+		for _, planet := range s.cluster(r).Planets {
+			dtos = append(dtos, newPlanetDTO(planet))
+		}
+		s.writeJSON(w, r, dtos)
+	}
+}
+
+func (s *Server) apiGetSpecie() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetSpecie: %s %s\n", r.Method, r.URL.Path)
+		specie, ok := s.apiSpecie(r)
+		if !ok {
+			apiError(w, http.StatusNotFound)
+			return
+		}
+		s.writeJSON(w, r, newSpeciesDTO(specie))
+	}
+}
+
+func (s *Server) apiGetSpecieColonies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetSpecieColonies: %s %s\n", r.Method, r.URL.Path)
+		specie, ok := s.apiSpecie(r)
+		if !ok {
+			apiError(w, http.StatusNotFound)
+			return
+		}
+		dtos := []colonyDTO{}
+		for _, colony := range specie.Colonies {
+			dtos = append(dtos, newColonyDTO(colony))
+		}
+		s.writeJSON(w, r, dtos)
+	}
+}
+
+func (s *Server) apiGetSpecieColony() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetSpecieColony: %s %s\n", r.Method, r.URL.Path)
+		specie, ok := s.apiSpecie(r)
+		if !ok {
+			apiError(w, http.StatusNotFound)
+			return
+		}
+		colonyId, err := way.ParamInt(r.Context(), "cid")
+		colony := specie.LookupColony(colonyId)
+		if err != nil || colony == nil {
+			apiError(w, http.StatusNotFound)
+			return
+		}
+		s.writeJSON(w, r, newColonyDTO(colony))
+	}
+}
+
+func (s *Server) apiGetSpecieShip() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetSpecieShip: %s %s\n", r.Method, r.URL.Path)
+		specie, ok := s.apiSpecie(r)
+		if !ok {
+			apiError(w, http.StatusNotFound)
+			return
+		}
+		shipId, err := way.ParamInt(r.Context(), "sid")
+		ship := specie.LookupShip(shipId)
+		if err != nil || ship == nil {
+			apiError(w, http.StatusNotFound)
+			return
+		}
+		s.writeJSON(w, r, newShipDTO(ship))
+	}
+}
+
+func (s *Server) apiGetSpecieShips() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetSpecieShips: %s %s\n", r.Method, r.URL.Path)
+		specie, ok := s.apiSpecie(r)
+		if !ok {
+			apiError(w, http.StatusNotFound)
+			return
+		}
+		dtos := []shipDTO{}
+		for _, ship := range specie.Ships {
+			dtos = append(dtos, newShipDTO(ship))
+		}
+		s.writeJSON(w, r, dtos)
+	}
+}
+
+func (s *Server) apiGetSpecies() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetSpecies: %s %s\n", r.Method, r.URL.Path)
+		dtos := []speciesDTO{}
+		for _, specie := range s.cluster(r).Species {
+			dtos = append(dtos, newSpeciesDTO(specie))
+		}
+		s.writeJSON(w, r, dtos)
+	}
+}
+
+func (s *Server) apiGetTurns() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetTurns: %s %s\n", r.Method, r.URL.Path)
+		turns := s.store.Turns()
+		s.writeJSON(w, r, turnsDTO{Latest: turns[len(turns)-1], Turns: turns})
+	}
+}
+
+func (s *Server) apiGetSystem() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetSystem: %s %s\n", r.Method, r.URL.Path)
+		id, err := way.ParamInt(r.Context(), "id")
+		system := s.cluster(r).LookupSystem(id)
+		if err != nil || system == nil {
+			apiError(w, http.StatusNotFound)
+			return
+		}
+		s.writeJSON(w, r, newSystemDTO(system))
+	}
+}
+
+func (s *Server) apiGetSystems() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("apiGetSystems: %s %s\n", r.Method, r.URL.Path)
+		dtos := []systemDTO{}
+		for _, system := range s.cluster(r).Systems {
+			dtos = append(dtos, newSystemDTO(system))
+		}
+		s.writeJSON(w, r, dtos)
+	}
+}
+
+// apiPlanet returns the planet named by the ":id" parameter.
+func (s *Server) apiPlanet(r *http.Request) (*fhdata.Planet, bool) {
+	id, err := way.ParamInt(r.Context(), "id")
+	planet := s.cluster(r).LookupPlanet(id)
+	return planet, err == nil && planet != nil
+}
+
+// apiSpecie returns the species named by the ":id" parameter.
+func (s *Server) apiSpecie(r *http.Request) (*fhdata.Species, bool) {
+	id, err := way.ParamInt(r.Context(), "id")
+	specie := s.cluster(r).LookupSpecies(id)
+	return specie, err == nil && specie != nil
+}
+
+// apiError writes a JSON error body with the status text for the code.
+func apiError(w http.ResponseWriter, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{Error: http.StatusText(code)})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, data interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("writeJSON: %s %s: %+v\n", r.Method, r.URL.Path, err)
+		apiError(w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = w.Write(b)
+}
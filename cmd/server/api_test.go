@@ -0,0 +1,222 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeJSON checks the status and content type of an api response and
+// decodes the body into v. Fields that are not in v are an error, so the
+// DTOs must describe the whole body.
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, code int, v interface{}) {
+	t.Helper()
+	if w.Code != code {
+		t.Fatalf("status: want %d: got %d: %s", code, w.Code, w.Body.String())
+	} else if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Fatalf("content type: want json: got %q", ct)
+	}
+	dec := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		t.Fatalf("decode: %v: %s", err, w.Body.String())
+	}
+}
+
+func TestAPITurns(t *testing.T) {
+	s := newTestServer(t, false)
+	var got turnsDTO
+	decodeJSON(t, get(s, "/api/v1/turns", "", 0), http.StatusOK, &got)
+	if want := (turnsDTO{Latest: 2, Turns: []int{1, 2}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v: got %+v", want, got)
+	}
+}
+
+func TestAPIEndpoints(t *testing.T) {
+	s := newTestServer(t, false)
+	// every endpoint is served for the latest turn and for a given turn
+	for _, tc := range []struct {
+		prefix string
+		banked int // Alpha's EUs, which differ between the turns
+	}{
+		{prefix: "/api/v1", banked: 200},
+		{prefix: "/api/v1/turns/2", banked: 200},
+		{prefix: "/api/v1/turns/1", banked: 100},
+	} {
+		var planets []planetDTO
+		decodeJSON(t, get(s, tc.prefix+"/planets", "", 0), http.StatusOK, &planets)
+		if len(planets) != 3 || planets[1].Id != 2 || planets[1].System != 2 || planets[1].Orbit != 1 ||
+			!reflect.DeepEqual(planets[1].Colonies, []colonyRefDTO{{Species: 2, Colony: 1}}) {
+			t.Errorf("%s/planets: got %+v", tc.prefix, planets)
+		}
+		var planet planetDTO
+		decodeJSON(t, get(s, tc.prefix+"/planets/3", "", 0), http.StatusOK, &planet)
+		if planet.Id != 3 || planet.Coords != (coordsDTO{X: 9, Y: 9, Z: 9}) || !reflect.DeepEqual(planet.Atmosphere, []gasDTO{{Code: "O2", Pct: 30}}) {
+			t.Errorf("%s/planets/3: got %+v", tc.prefix, planet)
+		}
+
+		var species []speciesDTO
+		decodeJSON(t, get(s, tc.prefix+"/species", "", 0), http.StatusOK, &species)
+		if len(species) != 2 || species[0].Name != "Alpha" || species[1].Name != "Beta" {
+			t.Errorf("%s/species: got %+v", tc.prefix, species)
+		}
+		var specie speciesDTO
+		decodeJSON(t, get(s, tc.prefix+"/species/1", "", 0), http.StatusOK, &specie)
+		if specie.Id != 1 || specie.HomeSystem != 1 || specie.HomePlanet != 1 || specie.EconUnitsBanked != tc.banked ||
+			!reflect.DeepEqual(specie.Contacts, []int{2}) || !reflect.DeepEqual(specie.Colonies, []int{1, 2}) || !reflect.DeepEqual(specie.Ships, []int{1}) {
+			t.Errorf("%s/species/1: got %+v", tc.prefix, specie)
+		}
+
+		var colonies []colonyDTO
+		decodeJSON(t, get(s, tc.prefix+"/species/2/colonies", "", 0), http.StatusOK, &colonies)
+		if len(colonies) != 2 || colonies[0].Name != "Nest" || colonies[1].Name != "Outpost" {
+			t.Errorf("%s/species/2/colonies: got %+v", tc.prefix, colonies)
+		}
+		var colony colonyDTO
+		decodeJSON(t, get(s, tc.prefix+"/species/2/colonies/2", "", 0), http.StatusOK, &colony)
+		if colony.Id != 2 || colony.Species != 2 || colony.System != 3 || colony.Planet != 3 || !colony.IsMiningColony || colony.MiningBase != 300 {
+			t.Errorf("%s/species/2/colonies/2: got %+v", tc.prefix, colony)
+		}
+
+		// a colony in deep space has no system or planet
+		colony = colonyDTO{}
+		decodeJSON(t, get(s, tc.prefix+"/species/1/colonies/2", "", 0), http.StatusOK, &colony)
+		if colony.Name != "Drifter" || colony.System != 0 || colony.Planet != 0 || colony.Coords != (coordsDTO{X: 2, Y: 2, Z: 2}) {
+			t.Errorf("%s/species/1/colonies/2: got %+v", tc.prefix, colony)
+		}
+
+		var ships []shipDTO
+		decodeJSON(t, get(s, tc.prefix+"/species/1/ships", "", 0), http.StatusOK, &ships)
+		if len(ships) != 1 || ships[0].Name != "Scout" {
+			t.Errorf("%s/species/1/ships: got %+v", tc.prefix, ships)
+		}
+		var ship shipDTO
+		decodeJSON(t, get(s, tc.prefix+"/species/1/ships/1", "", 0), http.StatusOK, &ship)
+		if ship.Id != 1 || ship.Class != "PB" || ship.Status != "In Orbit" || ship.Location.System != 2 || ship.Location.Planet != 2 || len(ship.Inventory) != 1 {
+			t.Errorf("%s/species/1/ships/1: got %+v", tc.prefix, ship)
+		}
+
+		var systems []systemDTO
+		decodeJSON(t, get(s, tc.prefix+"/systems", "", 0), http.StatusOK, &systems)
+		if len(systems) != 3 {
+			t.Errorf("%s/systems: got %+v", tc.prefix, systems)
+		}
+		var system systemDTO
+		decodeJSON(t, get(s, tc.prefix+"/systems/2", "", 0), http.StatusOK, &system)
+		if system.Id != 2 || !system.IsHomeSystem || !reflect.DeepEqual(system.Planets, []int{2}) ||
+			!reflect.DeepEqual(system.VisitedBy, []int{1, 2}) || !reflect.DeepEqual(system.ScannedBy, []int{1, 2}) {
+			t.Errorf("%s/systems/2: got %+v", tc.prefix, system)
+		}
+	}
+}
+
+func TestAPINotFound(t *testing.T) {
+	s := newTestServer(t, false)
+	for _, path := range []string{
+		"/api/v1/planets/4",
+		"/api/v1/planets/0",
+		"/api/v1/species/3",
+		"/api/v1/species/3/colonies",
+		"/api/v1/species/1/colonies/3",
+		"/api/v1/species/1/ships/2",
+		"/api/v1/species/3/ships",
+		"/api/v1/systems/4",
+		"/api/v1/turns/3/planets",
+		"/api/v1/turns/0/species/1",
+		"/api/v1/turns/1/systems/99",
+		"/api/v1/unknown",
+		// the turn and ids must be integers
+		"/api/v1/turns/latest/planets",
+		"/api/v1/turns/1.5/planets",
+		"/api/v1/turns/-/systems",
+		"/api/v1/planets/one",
+		"/api/v1/species/1/ships/x",
+	} {
+		var got struct {
+			Error string `json:"error"`
+		}
+		w := get(s, path, "", 0)
+		decodeJSON(t, w, http.StatusNotFound, &got)
+		if got.Error != "Not Found" {
+			t.Errorf("%s: want Not Found: got %q", path, got.Error)
+		}
+	}
+}
+
+func TestAPIFogOfWar(t *testing.T) {
+	s := newTestServer(t, true)
+
+	// without a session the api does not redirect to the login page
+	if w := get(s, "/api/v1/species", "", 0); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"error":"Unauthorized"`) {
+		t.Errorf("no session: want 401: got %d %s", w.Code, w.Body.String())
+	}
+
+	// the game master sees everything
+	var systems []systemDTO
+	decodeJSON(t, get(s, "/api/v1/systems", "gm", 0), http.StatusOK, &systems)
+	if len(systems) != 3 {
+		t.Errorf("gm: systems: want 3: got %d", len(systems))
+	}
+
+	// alpha sees its own systems and the system its scout is in
+	for _, prefix := range []string{"/api/v1", "/api/v1/turns/1"} {
+		systems = nil
+		decodeJSON(t, get(s, prefix+"/systems", "alpha", 1), http.StatusOK, &systems)
+		if len(systems) != 2 || systems[0].Id != 1 || systems[1].Id != 2 {
+			t.Errorf("%s: alpha: systems: got %+v", prefix, systems)
+		}
+		for _, path := range []string{"/systems/3", "/planets/3", "/species/2/colonies/2"} {
+			if w := get(s, prefix+path, "alpha", 1); w.Code != http.StatusNotFound {
+				t.Errorf("%s%s: alpha: want 404: got %d", prefix, path, w.Code)
+			}
+		}
+
+		var own speciesDTO
+		decodeJSON(t, get(s, prefix+"/species/1", "alpha", 1), http.StatusOK, &own)
+		if own.EconUnitsBanked == 0 || own.FleetMaintenanceCost != 7 || own.Tech["MI"].CurrentLevel != 10 {
+			t.Errorf("%s: alpha: own species: got %+v", prefix, own)
+		}
+		var other speciesDTO
+		decodeJSON(t, get(s, prefix+"/species/2", "alpha", 1), http.StatusOK, &other)
+		if other.Name != "Beta" || other.EconUnitsBanked != 0 || other.Tech["MI"].CurrentLevel != 0 || len(other.Contacts) != 0 {
+			t.Errorf("%s: alpha: other species: got %+v", prefix, other)
+		}
+		var colonies []colonyDTO
+		decodeJSON(t, get(s, prefix+"/species/2/colonies", "alpha", 1), http.StatusOK, &colonies)
+		if len(colonies) != 1 || colonies[0].Name != "Nest" || colonies[0].PopulationUnits != 0 || len(colonies[0].Inventory) != 0 {
+			t.Errorf("%s: alpha: other colonies: got %+v", prefix, colonies)
+		}
+		var ships []shipDTO
+		decodeJSON(t, get(s, prefix+"/species/2/ships", "alpha", 1), http.StatusOK, &ships)
+		if len(ships) != 1 || ships[0].Name != "Drone" || len(ships[0].Inventory) != 0 {
+			t.Errorf("%s: alpha: other ships: got %+v", prefix, ships)
+		}
+	}
+}
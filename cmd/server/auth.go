@@ -0,0 +1,334 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// account is a login from the credentials file.
+type account struct {
+	Name    string
+	Species int // zero for the game master
+	Hash    []byte
+}
+
+// loadCredentials reads a credentials file. Each line is
+//
+//	name:species:bcrypt-hash
+//
+// where species is a species number or "gm" for the game master.
+// Blank lines and lines starting with "#" are ignored.
+func loadCredentials(name string) (map[string]*account, error) {
+	fp, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	accounts := make(map[string]*account)
+	scanner, lineNo := bufio.NewScanner(fp), 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || fields[0] == "" {
+			return nil, fmt.Errorf("%s:%d: want name:species:hash", name, lineNo)
+		}
+		acct := &account{Name: fields[0], Hash: []byte(fields[2])}
+		if fields[1] != "gm" {
+			if acct.Species, err = strconv.Atoi(fields[1]); err != nil || acct.Species < 1 {
+				return nil, fmt.Errorf("%s:%d: species %q: want a species number or \"gm\"", name, lineNo, fields[1])
+			}
+		}
+		if _, err := bcrypt.Cost(acct.Hash); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNo, err)
+		} else if _, ok := accounts[acct.Name]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate account %q", name, lineNo, acct.Name)
+		}
+		accounts[acct.Name] = acct
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// session is the signed content of the session cookie.
+type session struct {
+	Name    string
+	Species int // zero for the game master
+	Expires time.Time
+}
+
+const sessionCookie = "fhdata_session"
+
+// loginCookie holds the token that the login form must post back,
+// so that another site can't log a visitor in to an account of its choosing.
+const loginCookie = "fhdata_login"
+
+var errBadSession = errors.New("invalid session")
+
+type contextKey string
+
+const sessionContextKey = contextKey("session")
+
+// sessionFrom returns the session stored in the context, or nil.
+func sessionFrom(ctx context.Context) *session {
+	sess, _ := ctx.Value(sessionContextKey).(*session)
+	return sess
+}
+
+// encode returns the cookie value for the session.
+// The value is the payload and its HMAC, both base64 encoded.
+func (sess *session) encode(key []byte) string {
+	payload := fmt.Sprintf("%s|%d|%d", sess.Name, sess.Species, sess.Expires.Unix())
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// decodeSession verifies the signature and expiration of a cookie value.
+func decodeSession(key []byte, value string, now time.Time) (*session, error) {
+	fields := strings.Split(value, ".")
+	if len(fields) != 2 {
+		return nil, errBadSession
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(fields[0])
+	if err != nil {
+		return nil, errBadSession
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, errBadSession
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errBadSession
+	}
+	// the name is the only field that may contain the separator
+	parts := strings.Split(string(payload), "|")
+	if len(parts) < 3 {
+		return nil, errBadSession
+	}
+	n := len(parts)
+	species, err := strconv.Atoi(parts[n-2])
+	if err != nil {
+		return nil, errBadSession
+	}
+	expires, err := strconv.ParseInt(parts[n-1], 10, 64)
+	if err != nil {
+		return nil, errBadSession
+	}
+	sess := &session{Name: strings.Join(parts[:n-2], "|"), Species: species, Expires: time.Unix(expires, 0)}
+	if !now.Before(sess.Expires) {
+		return nil, errBadSession
+	}
+	return sess, nil
+}
+
+// authenticate requires a valid session for every route except the
+// login page. The session is stored in the request context.
+// When there are no accounts, every request is the game master.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.accounts == nil || r.URL.Path == "/login" || r.URL.Path == "/manifest.json" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sess, err := s.session(r)
+		if err != nil {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				apiError(w, http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey, sess)))
+	})
+}
+
+// session returns the caller's session. The account must still exist
+// with the same species, so removing it from the file ends the session.
+func (s *Server) session(r *http.Request) (*session, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, errBadSession
+	}
+	sess, err := decodeSession(s.sessionKey, cookie.Value, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if acct, ok := s.accounts[sess.Name]; !ok || acct.Species != sess.Species {
+		return nil, errBadSession
+	}
+	return sess, nil
+}
+
+func (s *Server) getLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("getLogin: %s %s\n", r.Method, r.URL.Path)
+		s.renderLogin(w, r, http.StatusOK, "")
+	}
+}
+
+func (s *Server) postLogin() http.HandlerFunc {
+	// compared against when the account does not exist, so that
+	// unknown names take as long as bad passwords
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("postLogin: %s %s\n", r.Method, r.URL.Path)
+		if s.accounts == nil {
+			http.Redirect(w, r, "/home", http.StatusSeeOther)
+			return
+		}
+		if !validLoginToken(r) {
+			log.Printf("postLogin: %s %s: missing or invalid login token\n", r.Method, r.URL.Path)
+			s.renderLogin(w, r, http.StatusForbidden, "The login form expired. Please try again.")
+			return
+		}
+		name, password := r.PostFormValue("name"), r.PostFormValue("password")
+		acct, ok := s.accounts[name]
+		hash := dummyHash
+		if ok {
+			hash = acct.Hash
+		}
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !ok {
+			log.Printf("postLogin: %s %s: login failed for %q\n", r.Method, r.URL.Path, name)
+			s.renderLogin(w, r, http.StatusUnauthorized, "Invalid name or password.")
+			return
+		}
+		sess := &session{Name: acct.Name, Species: acct.Species, Expires: time.Now().Add(s.sessionTTL)}
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    sess.encode(s.sessionKey),
+			Path:     "/",
+			Expires:  sess.Expires,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, safeNext(r.PostFormValue("next")), http.StatusSeeOther)
+	}
+}
+
+func (s *Server) getLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("getLogout: %s %s\n", r.Method, r.URL.Path)
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	}
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, r *http.Request, code int, message string) {
+	token, err := loginToken(w, r)
+	if err != nil {
+		log.Printf("renderLogin: %s %s: %+v\n", r.Method, r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	b, err := s.render(r, "login", struct {
+		Error string
+		Next  string
+		Token string
+	}{Error: message, Next: safeNext(r.FormValue("next")), Token: token})
+	if err != nil {
+		log.Printf("renderLogin: %s %s: %+v\n", r.Method, r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
+
+// loginToken returns the token for the login form. It reuses the token
+// in the login cookie, or sets the cookie with a new random one.
+func loginToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(loginCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    token,
+		Path:     "/login",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, nil
+}
+
+// validLoginToken returns true if the token posted with the login form
+// matches the one in the login cookie.
+func validLoginToken(r *http.Request) bool {
+	cookie, err := r.Cookie(loginCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return hmac.Equal([]byte(cookie.Value), []byte(r.PostFormValue("token")))
+}
+
+// safeNext returns the local path to redirect to after logging in.
+// Anything that could leave the site is replaced with the home page.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/home"
+	}
+	return next
+}
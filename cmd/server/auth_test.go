@@ -0,0 +1,192 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionEncodeDecode(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Unix(1_700_000_000, 0)
+	for _, sess := range []*session{
+		{Name: "alice", Species: 2, Expires: now.Add(time.Hour)},
+		{Name: "gm", Species: 0, Expires: now.Add(time.Second)},
+		{Name: "a|b||c", Species: 12, Expires: now.Add(time.Hour)},
+		{Name: "", Species: 1, Expires: now.Add(time.Hour)},
+	} {
+		got, err := decodeSession(key, sess.encode(key), now)
+		if err != nil {
+			t.Errorf("%q: want nil: got %v", sess.Name, err)
+		} else if got.Name != sess.Name || got.Species != sess.Species || !got.Expires.Equal(sess.Expires) {
+			t.Errorf("%q: want %+v: got %+v", sess.Name, *sess, *got)
+		}
+	}
+}
+
+func TestDecodeSessionRejects(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Unix(1_700_000_000, 0)
+	valid := (&session{Name: "alice", Species: 2, Expires: now.Add(time.Hour)}).encode(key)
+	payload, sig := valid[:strings.IndexByte(valid, '.')], valid[strings.IndexByte(valid, '.')+1:]
+	forged := (&session{Name: "alice", Species: 0, Expires: now.Add(time.Hour)}).encode(key)
+	forgedPayload := forged[:strings.IndexByte(forged, '.')]
+
+	// change the first character of the signature; the last may be padding bits
+	b := []byte(sig)
+	if b[0] == 'A' {
+		b[0] = 'B'
+	} else {
+		b[0] = 'A'
+	}
+	tampered := payload + "." + string(b)
+
+	for _, tc := range []struct {
+		name  string
+		value string
+		key   []byte
+		now   time.Time
+	}{
+		{"tampered signature", tampered, key, now},
+		{"tampered payload", forgedPayload + "." + sig, key, now},
+		{"other key", valid, []byte("another key"), now},
+		{"expired", valid, key, now.Add(2 * time.Hour)},
+		{"expires now", valid, key, now.Add(time.Hour)},
+		{"no signature", payload, key, now},
+		{"extra field", valid + ".x", key, now},
+		{"bad base64", "!!." + sig, key, now},
+		{"empty", "", key, now},
+	} {
+		if sess, err := decodeSession(tc.key, tc.value, tc.now); err != errBadSession {
+			t.Errorf("%s: want errBadSession: got %v, %v", tc.name, sess, err)
+		}
+	}
+}
+
+func TestServerSession(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	s := &Server{
+		accounts: map[string]*account{
+			"alice": {Name: "alice", Species: 2},
+			"gm":    {Name: "gm", Species: 0},
+		},
+		sessionKey: key,
+	}
+	expires := time.Now().Add(time.Hour)
+	for _, tc := range []struct {
+		name string
+		sess *session
+		ok   bool
+	}{
+		{"player", &session{Name: "alice", Species: 2, Expires: expires}, true},
+		{"game master", &session{Name: "gm", Species: 0, Expires: expires}, true},
+		{"deleted account", &session{Name: "bob", Species: 3, Expires: expires}, false},
+		{"changed species", &session{Name: "alice", Species: 3, Expires: expires}, false},
+		{"now the game master", &session{Name: "gm", Species: 1, Expires: expires}, false},
+	} {
+		r := httptest.NewRequest("GET", "/home", nil)
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: tc.sess.encode(key)})
+		if _, err := s.session(r); (err == nil) != tc.ok {
+			t.Errorf("%s: want ok %v: got %v", tc.name, tc.ok, err)
+		}
+	}
+	if _, err := s.session(httptest.NewRequest("GET", "/home", nil)); err != errBadSession {
+		t.Errorf("no cookie: want errBadSession: got %v", err)
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	for _, tc := range []struct {
+		next, want string
+	}{
+		{"", "/home"},
+		{"/turn/3/planets?sort=name", "/turn/3/planets?sort=name"},
+		{"/", "/"},
+		{"//evil", "/home"},
+		{"//evil/path", "/home"},
+		{"/\\evil", "/home"},
+		{"https://evil", "/home"},
+		{"http:/evil", "/home"},
+		{"evil", "/home"},
+		{"javascript:alert(1)", "/home"},
+	} {
+		if got := safeNext(tc.next); got != tc.want {
+			t.Errorf("%q: want %q: got %q", tc.next, tc.want, got)
+		}
+	}
+}
+
+func TestLoginToken(t *testing.T) {
+	s := newTestServer(t, true)
+
+	// the login page sets the cookie and puts the same token in the form
+	w := get(s, "/login", "", 0)
+	var token string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == loginCookie {
+			token = c.Value
+		}
+	}
+	if w.Code != http.StatusOK || token == "" {
+		t.Fatalf("get: want 200 and a login cookie: got %d %q", w.Code, token)
+	} else if !strings.Contains(w.Body.String(), `name="token" value="`+token+`"`) {
+		t.Fatalf("get: want the token in the form: got %s", w.Body.String())
+	}
+
+	for _, tc := range []struct {
+		name   string
+		cookie string // the login cookie, if not empty
+		form   string // the token in the form
+		code   int
+	}{
+		{"valid", token, token, http.StatusSeeOther},
+		{"no cookie", "", token, http.StatusForbidden},
+		{"no token", token, "", http.StatusForbidden},
+		{"other token", token, "x" + token[1:], http.StatusForbidden},
+		{"both empty", "", "", http.StatusForbidden},
+	} {
+		form := url.Values{"name": {"alpha"}, "password": {"secret"}, "next": {"/specie/1"}, "token": {tc.form}}
+		r := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tc.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: loginCookie, Value: tc.cookie})
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		var loggedIn bool
+		for _, c := range w.Result().Cookies() {
+			loggedIn = loggedIn || (c.Name == sessionCookie && c.Value != "")
+		}
+		if w.Code != tc.code || loggedIn != (tc.code == http.StatusSeeOther) {
+			t.Errorf("%s: want %d: got %d, logged in %v", tc.name, tc.code, w.Code, loggedIn)
+		} else if tc.code == http.StatusSeeOther && w.Header().Get("Location") != "/specie/1" {
+			t.Errorf("%s: want /specie/1: got %q", tc.name, w.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,320 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/mdhender/fhdata"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config is the server configuration. Each setting comes from, in
+// increasing order of precedence, the default, the JSON config file,
+// an FHDATA_* environment variable, and a command line flag.
+type config struct {
+	Host          string   `json:"host"`
+	Port          int      `json:"port"`
+	Data          string   `json:"data"`      // a turn, or a directory of turns
+	Templates     string   `json:"templates"` // optional directory of templates that replace the embedded ones
+	DevTemplates  bool     `json:"dev_templates"`
+	ByteOrder     string   `json:"byte_order"` // "auto", "little" or "big"
+	CacheTurns    int      `json:"cache_turns"`
+	ReadTimeout   duration `json:"read_timeout"`
+	WriteTimeout  duration `json:"write_timeout"`
+	Watch         bool     `json:"watch"`
+	WatchInterval duration `json:"watch_interval"`
+	WatchSettle   duration `json:"watch_settle"`
+	Species       int      `json:"species"`     // restrict the server to one species, 0 for none
+	Credentials   string   `json:"credentials"` // path to the credentials file, empty to disable logins
+	SessionKey    string   `json:"session_key"`
+	SessionTTL    duration `json:"session_ttl"`
+}
+
+func defaultConfig() *config {
+	return &config{
+		Port:          9187,
+		Data:          ".",
+		ByteOrder:     "auto",
+		CacheTurns:    8,
+		ReadTimeout:   duration(5 * time.Second),
+		WriteTimeout:  duration(10 * time.Second),
+		Watch:         true,
+		WatchInterval: duration(2 * time.Second),
+		WatchSettle:   duration(5 * time.Second),
+		SessionTTL:    duration(24 * time.Hour),
+	}
+}
+
+// setting is a config field that can be set from a flag or the environment.
+// The environment variable is FHDATA_ and the flag name in upper case,
+// with dashes changed to underscores.
+type setting struct {
+	name  string
+	usage string
+	ptr   interface{} // *string, *int, *bool or *duration
+}
+
+func (c *config) settings() []setting {
+	return []setting{
+		{"host", "host to listen on", &c.Host},
+		{"port", "port to listen on", &c.Port},
+		{"data", "path to a turn's data, or to a directory of turns", &c.Data},
+		{"templates", "optional directory of templates that replace the embedded ones", &c.Templates},
+		{"dev-templates", "parse the templates in the templates directory again when they change", &c.DevTemplates},
+		{"byte-order", "byte order of the data files: auto, little or big", &c.ByteOrder},
+		{"cache-turns", "number of turns to keep in memory", &c.CacheTurns},
+		{"read-timeout", "maximum duration for reading a request", &c.ReadTimeout},
+		{"write-timeout", "maximum duration for writing a response", &c.WriteTimeout},
+		{"watch", "reload the data when the engine writes a new turn", &c.Watch},
+		{"watch-interval", "how often to check the data files for changes", &c.WatchInterval},
+		{"watch-settle", "how long the data files must be unchanged before reloading", &c.WatchSettle},
+		{"species", "restrict the server to this species' view, 0 for none", &c.Species},
+		{"credentials", "path to the credentials file, empty to disable logins", &c.Credentials},
+		{"session-key", "key for signing session cookies, at least 32 bytes", &c.SessionKey},
+		{"session-ttl", "how long a login lasts", &c.SessionTTL},
+	}
+}
+
+func (s setting) env() string {
+	return "FHDATA_" + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+// loadConfig builds the configuration from the command line arguments
+// (without the program name) and the environment. It returns true if
+// the configuration should be printed instead of running the server.
+func loadConfig(args []string, lookupEnv func(string) (string, bool)) (*config, bool, error) {
+	cfg := defaultConfig()
+
+	// flags are parsed into a scratch config so that only the ones
+	// that were given override the file and the environment
+	flags := defaultConfig()
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	for _, s := range flags.settings() {
+		fs.Var(settingValue(s), s.name, fmt.Sprintf("%s (%s)", s.usage, s.env()))
+	}
+	configFile := fs.String("config", "", "path to a JSON config file (FHDATA_CONFIG)")
+	printConfig := fs.Bool("print-config", false, "print the configuration and exit")
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	} else if fs.NArg() != 0 {
+		return nil, false, fmt.Errorf("unexpected argument %q: use -data for the data path", fs.Arg(0))
+	}
+
+	if *configFile == "" {
+		*configFile, _ = lookupEnv("FHDATA_CONFIG")
+	}
+	if *configFile != "" {
+		data, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return nil, false, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, false, fmt.Errorf("%s: %w", *configFile, err)
+		}
+	}
+
+	for _, s := range cfg.settings() {
+		if value, ok := lookupEnv(s.env()); ok {
+			if err := settingValue(s).Set(value); err != nil {
+				return nil, false, fmt.Errorf("%s: %w", s.env(), err)
+			}
+		}
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, s := range cfg.settings() {
+		if given[s.name] {
+			_ = settingValue(s).Set(fs.Lookup(s.name).Value.String())
+		}
+	}
+
+	return cfg, *printConfig, cfg.validate()
+}
+
+// validate checks every setting, so that mistakes are reported at startup.
+func (c *config) validate() error {
+	var errs []string
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("port %d: must be 1 to 65535", c.Port))
+	}
+	if _, err := os.Stat(c.Data); err != nil {
+		errs = append(errs, fmt.Sprintf("data: %v", err))
+	}
+	if c.Templates != "" {
+		if fi, err := os.Stat(c.Templates); err != nil {
+			errs = append(errs, fmt.Sprintf("templates: %v", err))
+		} else if !fi.IsDir() {
+			errs = append(errs, fmt.Sprintf("templates: %s: not a directory", c.Templates))
+		}
+	}
+	if c.DevTemplates && c.Templates == "" {
+		errs = append(errs, "dev templates: needs a templates directory")
+	}
+	if _, err := c.layout(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if c.CacheTurns < 1 {
+		errs = append(errs, fmt.Sprintf("cache turns %d: must be at least 1", c.CacheTurns))
+	}
+	if c.ReadTimeout <= 0 {
+		errs = append(errs, "read timeout: must be positive")
+	}
+	if c.WriteTimeout <= 0 {
+		errs = append(errs, "write timeout: must be positive")
+	}
+	if c.WatchInterval <= 0 {
+		errs = append(errs, "watch interval: must be positive")
+	}
+	if c.WatchSettle < 0 {
+		errs = append(errs, "watch settle: must not be negative")
+	}
+	if c.Species < 0 || c.Species > fhdata.MAX_SPECIES {
+		errs = append(errs, fmt.Sprintf("species %d: must be 0 to %d", c.Species, fhdata.MAX_SPECIES))
+	}
+	if c.Credentials != "" {
+		if _, err := os.Stat(c.Credentials); err != nil {
+			errs = append(errs, fmt.Sprintf("credentials: %v", err))
+		}
+	}
+	if c.SessionKey != "" && len(c.SessionKey) < 32 {
+		errs = append(errs, fmt.Sprintf("session key: want at least 32 bytes, got %d", len(c.SessionKey)))
+	}
+	if c.SessionTTL <= 0 {
+		errs = append(errs, "session ttl: must be positive")
+	}
+	if errs != nil {
+		return errors.New("config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// layout returns the layout for the byte order, or nil to detect it.
+func (c *config) layout() (*fhdata.Layout, error) {
+	switch c.ByteOrder {
+	case "auto":
+		return nil, nil
+	case "little":
+		return fhdata.NewLayout(binary.LittleEndian), nil
+	case "big":
+		return fhdata.NewLayout(binary.BigEndian), nil
+	}
+	return nil, fmt.Errorf("byte order %q: want auto, little or big", c.ByteOrder)
+}
+
+// print writes the configuration as JSON, with the session key hidden.
+func (c *config) print(w io.Writer) error {
+	cp := *c
+	if cp.SessionKey != "" {
+		cp.SessionKey = "<redacted>"
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(cp)
+}
+
+// duration is a time.Duration that reads and writes strings like "5s".
+type duration time.Duration
+
+func (d duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// settingValue adapts a setting to flag.Value.
+type settingValue setting
+
+func (v settingValue) IsBoolFlag() bool {
+	_, ok := v.ptr.(*bool)
+	return ok
+}
+
+func (v settingValue) String() string {
+	switch p := v.ptr.(type) {
+	case *string:
+		return *p
+	case *int:
+		return strconv.Itoa(*p)
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *duration:
+		return p.String()
+	}
+	return ""
+}
+
+func (v settingValue) Set(value string) error {
+	switch p := v.ptr.(type) {
+	case *string:
+		*p = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*p = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*p = b
+	case *duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*p = duration(d)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(file, []byte(`{"host": "file", "port": 2000, "cache_turns": 3, "read_timeout": "7s", "watch": false}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "other.json")
+	if err := ioutil.WriteFile(other, []byte(`{"host": "other"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		host        string
+		port        int
+		cacheTurns  int
+		readTimeout time.Duration
+		watch       bool
+	}
+	for _, tc := range []struct {
+		name string
+		args []string
+		env  map[string]string
+		want want
+	}{
+		{
+			name: "default",
+			want: want{"", 9187, 8, 5 * time.Second, true},
+		},
+		{
+			name: "file",
+			args: []string{"-config", file},
+			want: want{"file", 2000, 3, 7 * time.Second, false},
+		},
+		{
+			name: "file from env",
+			env:  map[string]string{"FHDATA_CONFIG": file},
+			want: want{"file", 2000, 3, 7 * time.Second, false},
+		},
+		{
+			name: "flag names the file over env",
+			args: []string{"-config", other},
+			env:  map[string]string{"FHDATA_CONFIG": file},
+			want: want{"other", 9187, 8, 5 * time.Second, true},
+		},
+		{
+			name: "env over file",
+			args: []string{"-config", file},
+			env:  map[string]string{"FHDATA_PORT": "3000", "FHDATA_WATCH": "true", "FHDATA_READ_TIMEOUT": "9s"},
+			want: want{"file", 3000, 3, 9 * time.Second, true},
+		},
+		{
+			name: "env over default",
+			env:  map[string]string{"FHDATA_HOST": "env", "FHDATA_CACHE_TURNS": "2"},
+			want: want{"env", 9187, 2, 5 * time.Second, true},
+		},
+		{
+			name: "flag over env and file",
+			args: []string{"-config", file, "-port", "4000", "-watch", "-cache-turns=5"},
+			env:  map[string]string{"FHDATA_PORT": "3000", "FHDATA_WATCH": "false", "FHDATA_HOST": "env"},
+			want: want{"env", 4000, 5, 7 * time.Second, true},
+		},
+		{
+			name: "flag equal to the default still wins",
+			args: []string{"-config", file, "-port", "9187", "-read-timeout", "5s"},
+			env:  map[string]string{"FHDATA_PORT": "3000"},
+			want: want{"file", 9187, 3, 5 * time.Second, false},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lookupEnv := func(key string) (string, bool) {
+				value, ok := tc.env[key]
+				return value, ok
+			}
+			cfg, _, err := loadConfig(tc.args, lookupEnv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := want{cfg.Host, cfg.Port, cfg.CacheTurns, time.Duration(cfg.ReadTimeout), cfg.Watch}
+			if got != tc.want {
+				t.Errorf("want %+v: got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	unknown := filepath.Join(dir, "unknown.json")
+	if err := ioutil.WriteFile(unknown, []byte(`{"prot": 2000}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		args []string
+		env  map[string]string
+		err  string
+	}{
+		{"bad env value", nil, map[string]string{"FHDATA_PORT": "x"}, "FHDATA_PORT"},
+		{"unknown file field", []string{"-config", unknown}, nil, `unknown field "prot"`},
+		{"missing file", []string{"-config", filepath.Join(dir, "missing.json")}, nil, "missing.json"},
+		{"argument", []string{"turns"}, nil, `unexpected argument "turns"`},
+		{"invalid", []string{"-port", "0", "-byte-order", "middle"}, nil, "port 0"},
+		{"invalid env", nil, map[string]string{"FHDATA_SESSION_KEY": "short"}, "session key"},
+		{"dev templates without a directory", []string{"-dev-templates"}, nil, "dev templates: needs a templates directory"},
+	} {
+		lookupEnv := func(key string) (string, bool) {
+			value, ok := tc.env[key]
+			return value, ok
+		}
+		if _, _, err := loadConfig(tc.args, lookupEnv); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: want error %q: got %v", tc.name, tc.err, err)
+		}
+	}
+}
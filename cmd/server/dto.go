@@ -0,0 +1,422 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"github.com/mdhender/fhdata"
+	"sort"
+)
+
+// the DTOs are the stable JSON representation of the cluster.
+// links between objects are id references rather than pointers.
+
+type coordsDTO struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	Z int `json:"z"`
+}
+
+type colonyRefDTO struct {
+	Species int `json:"species"`
+	Colony  int `json:"colony"`
+}
+
+type colonyDTO struct {
+	Id                int         `json:"id"`
+	Species           int         `json:"species"`
+	Name              string      `json:"name"`
+	System            int         `json:"system,omitempty"`
+	Planet            int         `json:"planet,omitempty"`
+	Coords            coordsDTO   `json:"coords"`
+	Orbit             int         `json:"orbit"`
+	IsHomePlanet      bool        `json:"is_home_planet"`
+	IsColony          bool        `json:"is_colony"`
+	IsPopulated       bool        `json:"is_populated"`
+	IsMiningColony    bool        `json:"is_mining_colony"`
+	IsResortColony    bool        `json:"is_resort_colony"`
+	IsDisbandedColony bool        `json:"is_disbanded_colony"`
+	Hidden            bool        `json:"hidden"`
+	Hiding            bool        `json:"hiding"`
+	LSN               int         `json:"lsn"`
+	PopulationUnits   int         `json:"population_units"`
+	MiningBase        int         `json:"mining_base"`
+	ManufacturingBase int         `json:"manufacturing_base"`
+	Production        int         `json:"production"`
+	Shipyards         int         `json:"shipyards"`
+	SiegeEffPct       int         `json:"siege_eff_pct"`
+	UseOnAmbush       int         `json:"use_on_ambush"`
+	DevelopAUs        *developDTO `json:"develop_aus,omitempty"`
+	DevelopIUs        *developDTO `json:"develop_ius,omitempty"`
+	Inventory         []itemDTO   `json:"inventory"`
+}
+
+type developDTO struct {
+	AutoInstall    int `json:"auto_install"`
+	UnitsNeeded    int `json:"units_needed"`
+	UnitsToInstall int `json:"units_to_install"`
+}
+
+type gasDTO struct {
+	Code string `json:"code"`
+	Pct  int    `json:"pct,omitempty"`
+}
+
+type itemDTO struct {
+	Code     string `json:"code"`
+	Quantity int    `json:"quantity"`
+	Cargo    int    `json:"cargo"`
+	Cost     int    `json:"cost"`
+}
+
+type locationDTO struct {
+	Coords coordsDTO     `json:"coords"`
+	System int           `json:"system,omitempty"`
+	Planet int           `json:"planet,omitempty"`
+	Colony *colonyRefDTO `json:"colony,omitempty"`
+}
+
+type planetDTO struct {
+	Id                       int            `json:"id"`
+	System                   int            `json:"system"`
+	Coords                   coordsDTO      `json:"coords"`
+	Orbit                    int            `json:"orbit"`
+	Atmosphere               []gasDTO       `json:"atmosphere"`
+	Diameter                 int            `json:"diameter"`
+	EconEfficiency           int            `json:"econ_efficiency"`
+	Gravity                  int            `json:"gravity"`
+	MiningDifficulty         int            `json:"mining_difficulty"`
+	MiningDifficultyIncrease int            `json:"mining_difficulty_increase"`
+	PressureClass            int            `json:"pressure_class"`
+	TemperatureClass         int            `json:"temperature_class"`
+	IsIdealColonyPlanet      bool           `json:"is_ideal_colony_planet"`
+	IsIdealHomePlanet        bool           `json:"is_ideal_home_planet"`
+	IsRadioactiveHellHole    bool           `json:"is_radioactive_hell_hole"`
+	Message                  int            `json:"message"`
+	Colonies                 []colonyRefDTO `json:"colonies"`
+}
+
+type shipDTO struct {
+	Id                 int           `json:"id"`
+	Species            int           `json:"species"`
+	Name               string        `json:"name"`
+	Class              string        `json:"class"`
+	Size               int           `json:"size,omitempty"`
+	SubLight           bool          `json:"sub_light"`
+	Status             string        `json:"status"`
+	Hiding             bool          `json:"hiding"`
+	Location           locationDTO   `json:"location"`
+	Orbit              int           `json:"orbit"`
+	Destination        *locationDTO  `json:"destination,omitempty"`
+	LoadingPoint       *colonyRefDTO `json:"loading_point,omitempty"`
+	UnloadingPoint     *colonyRefDTO `json:"unloading_point,omitempty"`
+	Age                int           `json:"age"`
+	Tonnage            int           `json:"tonnage"`
+	CargoCapacity      int           `json:"cargo_capacity"`
+	TotalCost          int           `json:"total_cost"`
+	RemainingCost      int           `json:"remaining_cost"`
+	MaintenanceCost    int           `json:"maintenance_cost"`
+	JustJumped         bool          `json:"just_jumped"`
+	ArrivedViaWormhole bool          `json:"arrived_via_wormhole"`
+	Inventory          []itemDTO     `json:"inventory"`
+}
+
+type speciesDTO struct {
+	Id                   int                `json:"id"`
+	Name                 string             `json:"name"`
+	GovtName             string             `json:"govt_name"`
+	GovtType             string             `json:"govt_type"`
+	HomeSystem           int                `json:"home_system,omitempty"`
+	HomePlanet           int                `json:"home_planet,omitempty"`
+	AutoOrders           bool               `json:"auto_orders"`
+	EconUnitsBanked      int                `json:"econ_units_banked"`
+	EconUnitsProduced    int                `json:"econ_units_produced"`
+	FleetMaintenanceCost int                `json:"fleet_maintenance_cost"`
+	FleetMaintenancePct  int                `json:"fleet_maintenance_pct"`
+	Tech                 map[string]techDTO `json:"tech"`
+	RequiredGas          requiredGasDTO     `json:"required_gas"`
+	NeutralGases         []gasDTO           `json:"neutral_gases"`
+	PoisonGases          []gasDTO           `json:"poison_gases"`
+	Contacts             []int              `json:"contacts"`
+	Allies               []int              `json:"allies"`
+	Enemies              []int              `json:"enemies"`
+	Colonies             []int              `json:"colonies"`
+	Ships                []int              `json:"ships"`
+	SystemsScanned       []int              `json:"systems_scanned"`
+	SystemsVisited       []int              `json:"systems_visited"`
+}
+
+type requiredGasDTO struct {
+	Code   string `json:"code"`
+	MinPct int    `json:"min_pct"`
+	MaxPct int    `json:"max_pct"`
+}
+
+type systemDTO struct {
+	Id           int       `json:"id"`
+	Coords       coordsDTO `json:"coords"`
+	Color        string    `json:"color"`
+	Type         string    `json:"type"`
+	Size         int       `json:"size"`
+	IsHomeSystem bool      `json:"is_home_system"`
+	Message      int       `json:"message"`
+	Planets      []int     `json:"planets"`
+	WormholeExit int       `json:"wormhole_exit,omitempty"`
+	ScannedBy    []int     `json:"scanned_by"`
+	VisitedBy    []int     `json:"visited_by"`
+}
+
+type turnsDTO struct {
+	Latest int   `json:"latest"`
+	Turns  []int `json:"turns"`
+}
+
+type techDTO struct {
+	CurrentLevel   int `json:"current_level"`
+	InitialLevel   int `json:"initial_level"`
+	KnowledgeLevel int `json:"knowledge_level"`
+	XPs            int `json:"xps"`
+}
+
+func newColonyDTO(c *fhdata.Colony) colonyDTO {
+	dto := colonyDTO{
+		Id:                c.Id,
+		Species:           c.Species.Id,
+		Name:              c.Name,
+		Coords:            newCoordsDTO(c.Coords),
+		Orbit:             c.Orbit,
+		IsHomePlanet:      c.Is.HomePlanet,
+		IsColony:          c.Is.Colony,
+		IsPopulated:       c.Is.Populated,
+		IsMiningColony:    c.Is.MiningColony,
+		IsResortColony:    c.Is.ResortColony,
+		IsDisbandedColony: c.Is.DisbandedColony,
+		Hidden:            c.Is.Hidden,
+		Hiding:            c.Is.Hiding,
+		LSN:               c.LSN,
+		PopulationUnits:   c.PopulationUnits,
+		MiningBase:        c.MiningBase,
+		ManufacturingBase: c.ManufacturingBase,
+		Production:        c.Production,
+		Shipyards:         c.Shipyards,
+		SiegeEffPct:       c.SiegeEffPct,
+		UseOnAmbush:       c.UseOnAmbush,
+		DevelopAUs:        newDevelopDTO(c.DevelopAUs),
+		DevelopIUs:        newDevelopDTO(c.DevelopIUs),
+		Inventory:         newItemDTOs(c.Inventory),
+	}
+	if c.System != nil {
+		dto.System = c.System.Id
+	}
+	if c.Planet != nil {
+		dto.Planet = c.Planet.Id
+	}
+	return dto
+}
+
+func newColonyRefDTO(c *fhdata.Colony) *colonyRefDTO {
+	if c == nil {
+		return nil
+	}
+	return &colonyRefDTO{Species: c.Species.Id, Colony: c.Id}
+}
+
+func newCoordsDTO(c fhdata.Coords) coordsDTO {
+	return coordsDTO{X: c.X, Y: c.Y, Z: c.Z}
+}
+
+func newDevelopDTO(d *fhdata.Develop) *developDTO {
+	if d == nil {
+		return nil
+	}
+	return &developDTO{AutoInstall: d.AutoInstall, UnitsNeeded: d.UnitsNeeded, UnitsToInstall: d.UnitsToInstall}
+}
+
+func newGasDTOs(gases []fhdata.Gas) []gasDTO {
+	dtos := []gasDTO{}
+	for _, gas := range gases {
+		dtos = append(dtos, gasDTO{Code: gas.Code})
+	}
+	return dtos
+}
+
+func newItemDTOs(items []fhdata.Item) []itemDTO {
+	dtos := []itemDTO{}
+	for _, item := range items {
+		dtos = append(dtos, itemDTO{Code: item.Code, Quantity: item.Quantity, Cargo: item.Cargo, Cost: item.Cost})
+	}
+	return dtos
+}
+
+func newLocationDTO(l fhdata.Location) locationDTO {
+	dto := locationDTO{Coords: newCoordsDTO(l.Coords), Colony: newColonyRefDTO(l.Colony)}
+	if l.System != nil {
+		dto.System = l.System.Id
+	}
+	if l.Planet != nil {
+		dto.Planet = l.Planet.Id
+	}
+	return dto
+}
+
+func newPlanetDTO(p *fhdata.Planet) planetDTO {
+	dto := planetDTO{
+		Id:                       p.Id,
+		System:                   p.System.Id,
+		Coords:                   newCoordsDTO(p.Coords),
+		Orbit:                    p.Orbit,
+		Atmosphere:               []gasDTO{},
+		Diameter:                 p.Diameter,
+		EconEfficiency:           p.EconEfficiency,
+		Gravity:                  p.Gravity,
+		MiningDifficulty:         p.MiningDifficultyBase,
+		MiningDifficultyIncrease: p.MiningDifficultyIncrease,
+		PressureClass:            p.PressureClass,
+		TemperatureClass:         p.TemperatureClass,
+		IsIdealColonyPlanet:      p.Is.IdealColonyPlanet,
+		IsIdealHomePlanet:        p.Is.IdealHomePlanet,
+		IsRadioactiveHellHole:    p.Is.RadioactiveHellHole,
+		Message:                  p.Message,
+		Colonies:                 []colonyRefDTO{},
+	}
+	for _, gas := range p.Atmosphere {
+		dto.Atmosphere = append(dto.Atmosphere, gasDTO{Code: gas.Code, Pct: gas.Pct})
+	}
+	for _, colony := range p.Colonies {
+		dto.Colonies = append(dto.Colonies, *newColonyRefDTO(colony))
+	}
+	return dto
+}
+
+func newShipDTO(s *fhdata.Ship) shipDTO {
+	dto := shipDTO{
+		Id:                 s.Id,
+		Species:            s.Species.Id,
+		Name:               s.Name,
+		Class:              s.Class,
+		Size:               s.Size,
+		SubLight:           s.SubLight,
+		Status:             s.Status.String(),
+		Hiding:             s.Hiding,
+		Location:           newLocationDTO(s.Location),
+		Orbit:              s.Orbit,
+		LoadingPoint:       newColonyRefDTO(s.LoadingPoint),
+		UnloadingPoint:     newColonyRefDTO(s.UnloadingPoint),
+		Age:                s.Age,
+		Tonnage:            s.Tonnage,
+		CargoCapacity:      s.CargoCapacity,
+		TotalCost:          s.TotalCost,
+		RemainingCost:      s.RemainingCost,
+		MaintenanceCost:    s.MaintenanceCost,
+		JustJumped:         s.JustJumped,
+		ArrivedViaWormhole: s.ArrivedViaWormhole,
+		Inventory:          newItemDTOs(s.Inventory),
+	}
+	if s.Destination != nil {
+		destination := newLocationDTO(*s.Destination)
+		dto.Destination = &destination
+	}
+	return dto
+}
+
+func newSpeciesDTO(sp *fhdata.Species) speciesDTO {
+	dto := speciesDTO{
+		Id:                   sp.Id,
+		Name:                 sp.Name,
+		GovtName:             sp.GovtName,
+		GovtType:             sp.GovtType,
+		AutoOrders:           sp.AutoOrders,
+		EconUnitsBanked:      sp.EconUnitsBanked,
+		EconUnitsProduced:    sp.EconUnitsProduced,
+		FleetMaintenanceCost: sp.FleetMaintenanceCost,
+		FleetMaintenancePct:  sp.FleetMaintenancePct,
+		Tech:                 make(map[string]techDTO),
+		RequiredGas:          requiredGasDTO{Code: sp.Gases.Required.Code, MinPct: sp.Gases.Required.MinPct, MaxPct: sp.Gases.Required.MaxPct},
+		NeutralGases:         newGasDTOs(sp.Gases.Neutral),
+		PoisonGases:          newGasDTOs(sp.Gases.Poison),
+		Contacts:             speciesIds(sp.Contacts),
+		Allies:               speciesIds(sp.Allies),
+		Enemies:              speciesIds(sp.Enemies),
+		Colonies:             []int{},
+		Ships:                []int{},
+		SystemsScanned:       systemIds(sp.SystemsScanned),
+		SystemsVisited:       systemIds(sp.SystemsVisited),
+	}
+	if sp.HomeSystem != nil {
+		dto.HomeSystem = sp.HomeSystem.Id
+	}
+	if sp.HomePlanet != nil {
+		dto.HomePlanet = sp.HomePlanet.Id
+	}
+	for _, tech := range []fhdata.Tech{sp.MI, sp.MA, sp.ML, sp.GV, sp.LS, sp.BI} {
+		dto.Tech[tech.Code] = techDTO{CurrentLevel: tech.CurrentLevel, InitialLevel: tech.InitialLevel, KnowledgeLevel: tech.KnowledgeLevel, XPs: tech.XPs}
+	}
+	for _, colony := range sp.Colonies {
+		dto.Colonies = append(dto.Colonies, colony.Id)
+	}
+	for _, ship := range sp.Ships {
+		dto.Ships = append(dto.Ships, ship.Id)
+	}
+	return dto
+}
+
+func newSystemDTO(s *fhdata.System) systemDTO {
+	dto := systemDTO{
+		Id:           s.Id,
+		Coords:       newCoordsDTO(s.Coords),
+		Color:        s.Color.Code,
+		Type:         s.Type.Name,
+		Size:         s.Size,
+		IsHomeSystem: s.Is.HomeSystem,
+		Message:      s.Message,
+		Planets:      []int{},
+		ScannedBy:    speciesIds(s.ScannedBy),
+		VisitedBy:    speciesIds(s.VisitedBy),
+	}
+	for _, planet := range s.Planets {
+		dto.Planets = append(dto.Planets, planet.Id)
+	}
+	if s.WormholeExit != nil {
+		dto.WormholeExit = s.WormholeExit.Id
+	}
+	return dto
+}
+
+// speciesIds returns the sorted ids of the species in the map.
+func speciesIds(m map[string]*fhdata.Species) []int {
+	ids := []int{}
+	for _, sp := range m {
+		ids = append(ids, sp.Id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// systemIds returns the ids of the systems.
+func systemIds(systems []*fhdata.System) []int {
+	ids := []int{}
+	for _, system := range systems {
+		ids = append(ids, system.Id)
+	}
+	return ids
+}
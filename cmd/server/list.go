@@ -0,0 +1,620 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"fmt"
+	"github.com/mdhender/fhdata"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPerPage = 100
+	maxPerPage     = 1000
+)
+
+// listColumn is a sortable column of a list page.
+type listColumn struct {
+	key   string
+	label string
+	cmp   func(i, j int) int // compares rows i and j, which are in id order before sorting
+}
+
+// listQuery is the sort, filter and page state of a list page.
+// It comes from the query string so that every state has a link.
+type listQuery struct {
+	page    string     // name of the page, for building links
+	values  url.Values // the query string
+	columns []listColumn
+	sort    *listColumn
+	desc    bool
+	number  int // the page number, starting at 1
+	perPage int
+}
+
+// newListQuery reads the sort and page parameters.
+// The default sort is the first column, which should be the id.
+// The filters are read by the page with the bool, int, coords and species methods.
+func newListQuery(page string, values url.Values, columns []listColumn) (*listQuery, error) {
+	q := &listQuery{page: page, values: values, columns: columns, sort: &columns[0], number: 1, perPage: defaultPerPage}
+	if key := values.Get("sort"); key != "" {
+		q.sort = nil
+		for i := range columns {
+			if columns[i].key == key {
+				q.sort = &columns[i]
+			}
+		}
+		if q.sort == nil {
+			return nil, fmt.Errorf("sort %q: unknown column", key)
+		}
+	}
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.desc = true
+	default:
+		return nil, fmt.Errorf("order %q: must be asc or desc", order)
+	}
+	var err error
+	if q.number, err = q.int("page", 1); err != nil {
+		return nil, err
+	} else if q.number < 1 {
+		return nil, fmt.Errorf("page %d: must be at least 1", q.number)
+	}
+	if q.perPage, err = q.int("per_page", defaultPerPage); err != nil {
+		return nil, err
+	} else if q.perPage < 1 || q.perPage > maxPerPage {
+		return nil, fmt.Errorf("per_page %d: must be 1 to %d", q.perPage, maxPerPage)
+	}
+	// the offset of the first row on the page must fit in an int
+	if maxPage := math.MaxInt/q.perPage + 1; q.number > maxPage {
+		return nil, fmt.Errorf("page %d: must be at most %d", q.number, maxPage)
+	}
+	return q, nil
+}
+
+// bool returns the value of a yes/no filter, or nil if it is not set.
+func (q *listQuery) bool(name string) (*bool, error) {
+	v := q.values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s %q: must be true or false", name, v)
+	}
+	return &b, nil
+}
+
+// int returns the value of an integer parameter, or def if it is not set.
+func (q *listQuery) int(name string, def int) (int, error) {
+	v := q.values.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q: must be a number", name, v)
+	}
+	return n, nil
+}
+
+// optInt returns the value of an integer filter, or nil if it is not set.
+func (q *listQuery) optInt(name string) (*int, error) {
+	if q.values.Get(name) == "" {
+		return nil, nil
+	}
+	n, err := q.int(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// coords returns the value of an "x,y,z" parameter, or nil if it is not set.
+func (q *listQuery) coords(name string) (*fhdata.Coords, error) {
+	v := q.values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	fields := strings.Split(v, ",")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("%s %q: must be x,y,z", name, v)
+	}
+	var xyz [3]int
+	for i, field := range fields {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: must be x,y,z", name, v)
+		}
+		xyz[i] = n
+	}
+	return &fhdata.Coords{X: xyz[0], Y: xyz[1], Z: xyz[2]}, nil
+}
+
+// species returns the species named by id in a parameter, or nil if it is not set.
+// Species that are not in the viewer's cluster are an error.
+func (q *listQuery) species(c *fhdata.Cluster, name string) (*fhdata.Species, error) {
+	id, err := q.int(name, 0)
+	if err != nil || id == 0 {
+		return nil, err
+	}
+	species := c.LookupSpecies(id)
+	if species == nil {
+		return nil, fmt.Errorf("%s %d: no such species", name, id)
+	}
+	return species, nil
+}
+
+// sortRows sorts the rows, which must be in id order, by the selected column.
+// The sort is stable, so rows that compare equal stay in id order.
+func (q *listQuery) sortRows(rows interface{}) {
+	cmp := q.sort.cmp
+	if q.desc {
+		sort.SliceStable(rows, func(i, j int) bool { return cmp(i, j) > 0 })
+	} else {
+		sort.SliceStable(rows, func(i, j int) bool { return cmp(i, j) < 0 })
+	}
+}
+
+// bounds returns the range of rows on the current page.
+func (q *listQuery) bounds(total int) (lo, hi int) {
+	lo = (q.number - 1) * q.perPage
+	if lo > total {
+		lo = total
+	}
+	hi = lo + q.perPage
+	if hi > total {
+		hi = total
+	}
+	return lo, hi
+}
+
+// view returns the state of the page for the template.
+func (q *listQuery) view(total int) listView {
+	lo, hi := q.bounds(total)
+	v := listView{
+		Total:   total,
+		Page:    q.number,
+		Pages:   (total + q.perPage - 1) / q.perPage,
+		First:   lo + 1,
+		Last:    hi,
+		values:  q.values,
+		Sort:    q.sort.key,
+		Desc:    q.desc,
+		PerPage: q.perPage,
+	}
+	if v.Pages == 0 {
+		v.Pages = 1
+	}
+	for _, col := range q.columns {
+		h := listHeader{Label: col.label, Sorted: q.sort.key == col.key}
+		h.Desc = h.Sorted && q.desc
+		// a sorted column's link reverses the order
+		order := "asc"
+		if h.Sorted && !q.desc {
+			order = "desc"
+		}
+		h.Href = q.href(map[string]string{"sort": col.key, "order": order, "page": ""})
+		v.Columns = append(v.Columns, h)
+	}
+	if q.number > 1 {
+		v.PrevHref = q.href(map[string]string{"page": strconv.Itoa(q.number - 1)})
+	}
+	if q.number < v.Pages {
+		v.NextHref = q.href(map[string]string{"page": strconv.Itoa(q.number + 1)})
+	}
+	return v
+}
+
+// href returns a link to the page with some parameters changed.
+// Empty values remove the parameter.
+func (q *listQuery) href(set map[string]string) string {
+	values := url.Values{}
+	for k, v := range q.values {
+		if len(v) != 0 && v[0] != "" {
+			values.Set(k, v[0])
+		}
+	}
+	for k, v := range set {
+		if v == "" {
+			values.Del(k)
+		} else {
+			values.Set(k, v)
+		}
+	}
+	if len(values) == 0 {
+		return q.page
+	}
+	return q.page + "?" + values.Encode()
+}
+
+// listView is the sort, filter and page state of a list page, for its template.
+type listView struct {
+	Columns  []listHeader
+	Sort     string
+	Desc     bool
+	Total    int // rows that pass the filters
+	Page     int
+	Pages    int
+	PerPage  int
+	First    int // row number of the first row on the page, starting at 1
+	Last     int
+	PrevHref string
+	NextHref string
+	values   url.Values
+}
+
+// Filter returns the value of a filter, for filling in the filter form.
+func (v listView) Filter(name string) string {
+	return v.values.Get(name)
+}
+
+// Field returns the name and value of a filter, for the shared form controls.
+func (v listView) Field(name string) listField {
+	return listField{Name: name, Value: v.values.Get(name)}
+}
+
+type listField struct {
+	Name  string
+	Value string
+}
+
+// listHeader is a column heading with a link that sorts by the column.
+type listHeader struct {
+	Label  string
+	Href   string
+	Sorted bool
+	Desc   bool
+}
+
+// distance returns the distance between two points, in parsecs.
+func distance(a, b fhdata.Coords) float64 {
+	dx, dy, dz := float64(a.X-b.X), float64(a.Y-b.Y), float64(a.Z-b.Z)
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// compareInts, compareStrings and compareBools order values for the column comparisons.
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareStrings(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+func compareBools(a, b bool) int {
+	if a == b {
+		return 0
+	} else if !a {
+		return -1
+	}
+	return 1
+}
+
+func compareFloats(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareCoords(a, b fhdata.Coords) int {
+	if a.Less(b) {
+		return -1
+	} else if b.Less(a) {
+		return 1
+	}
+	return 0
+}
+
+// systemFilter holds the filters that the systems and planets pages share.
+type systemFilter struct {
+	color    string // star color code or name
+	wormhole *bool
+	visited  *fhdata.Species
+	scanned  *fhdata.Species
+	from     *fhdata.Coords
+	within   *int // maximum distance from the from coordinates
+}
+
+func newSystemFilter(c *fhdata.Cluster, q *listQuery) (f systemFilter, err error) {
+	f.color = strings.TrimSpace(q.values.Get("color"))
+	if f.wormhole, err = q.bool("wormhole"); err != nil {
+		return f, err
+	} else if f.visited, err = q.species(c, "visited"); err != nil {
+		return f, err
+	} else if f.scanned, err = q.species(c, "scanned"); err != nil {
+		return f, err
+	} else if f.from, err = q.coords("from"); err != nil {
+		return f, err
+	} else if f.within, err = q.optInt("within"); err != nil {
+		return f, err
+	}
+	if f.within != nil && f.from == nil {
+		return f, fmt.Errorf("within: requires from")
+	}
+	return f, nil
+}
+
+func (f systemFilter) match(system *fhdata.System) bool {
+	if f.color != "" && !strings.EqualFold(f.color, system.Color.Code) && !strings.EqualFold(f.color, system.Color.Name) {
+		return false
+	} else if f.wormhole != nil && *f.wormhole != (system.WormholeExit != nil) {
+		return false
+	} else if f.visited != nil && system.VisitedBy[f.visited.Name] == nil {
+		return false
+	} else if f.scanned != nil && system.ScannedBy[f.scanned.Name] == nil {
+		return false
+	} else if f.within != nil && distance(*f.from, system.Coords) > float64(*f.within) {
+		return false
+	}
+	return true
+}
+
+// systemsView is the data for the systems page.
+type systemsView struct {
+	listView
+	From *fhdata.Coords
+	Rows []*systemRow
+}
+
+type systemRow struct {
+	*fhdata.System
+	Distance float64 // from the from coordinates
+}
+
+func newSystemsView(c *fhdata.Cluster, values url.Values) (*systemsView, error) {
+	var rows []*systemRow
+	columns := []listColumn{
+		{"id", "ID", func(i, j int) int { return compareInts(rows[i].Id, rows[j].Id) }},
+		{"coords", "Coords", func(i, j int) int { return compareCoords(rows[i].Coords, rows[j].Coords) }},
+		{"color", "Color", func(i, j int) int { return compareStrings(rows[i].Color.Name, rows[j].Color.Name) }},
+		{"planets", "# Planets", func(i, j int) int { return compareInts(len(rows[i].Planets), len(rows[j].Planets)) }},
+		{"visitors", "# Visitors", func(i, j int) int { return compareInts(len(rows[i].VisitedBy), len(rows[j].VisitedBy)) }},
+		{"scanners", "# Scanners", func(i, j int) int { return compareInts(len(rows[i].ScannedBy), len(rows[j].ScannedBy)) }},
+		{"wormhole", "Wormhole Exit", func(i, j int) int {
+			return compareInts(systemId(rows[i].WormholeExit), systemId(rows[j].WormholeExit))
+		}},
+	}
+	if values.Get("from") != "" {
+		columns = append(columns, listColumn{"distance", "Distance", func(i, j int) int {
+			return compareFloats(rows[i].Distance, rows[j].Distance)
+		}})
+	}
+	q, err := newListQuery("systems", values, columns)
+	if err != nil {
+		return nil, err
+	}
+	f, err := newSystemFilter(c, q)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, system := range c.Systems {
+		if system == nil || !f.match(system) {
+			continue
+		}
+		row := &systemRow{System: system}
+		if f.from != nil {
+			row.Distance = distance(*f.from, system.Coords)
+		}
+		rows = append(rows, row)
+	}
+	q.sortRows(rows)
+	lo, hi := q.bounds(len(rows))
+	return &systemsView{listView: q.view(len(rows)), From: f.from, Rows: rows[lo:hi]}, nil
+}
+
+// systemId returns the id of the system, or 0 for none.
+func systemId(system *fhdata.System) int {
+	if system == nil {
+		return 0
+	}
+	return system.Id
+}
+
+// planetsView is the data for the planets page.
+type planetsView struct {
+	listView
+	From    *fhdata.Coords
+	Species *fhdata.Species // the species whose LSN is shown, nil for none
+	Rows    []*planetRow
+}
+
+type planetRow struct {
+	*fhdata.Planet
+	LSN      int     // for the species
+	Distance float64 // from the from coordinates
+}
+
+// newPlanetsView builds the planets page. The LSN column is for the
+// species in the query, or for the viewer if there is none.
+func newPlanetsView(c *fhdata.Cluster, viewer int, values url.Values) (*planetsView, error) {
+	var rows []*planetRow
+	columns := []listColumn{
+		{"id", "ID", func(i, j int) int { return compareInts(rows[i].Id, rows[j].Id) }},
+		{"system", "System", func(i, j int) int {
+			if n := compareCoords(rows[i].Coords, rows[j].Coords); n != 0 {
+				return n
+			}
+			return compareInts(rows[i].Orbit, rows[j].Orbit)
+		}},
+		{"orbit", "Orbit", func(i, j int) int { return compareInts(rows[i].Orbit, rows[j].Orbit) }},
+		{"diameter", "Diameter", func(i, j int) int { return compareInts(rows[i].Diameter, rows[j].Diameter) }},
+		{"gravity", "Gravity", func(i, j int) int { return compareInts(rows[i].Gravity, rows[j].Gravity) }},
+		{"temp", "Temperature Class", func(i, j int) int {
+			return compareInts(rows[i].TemperatureClass, rows[j].TemperatureClass)
+		}},
+		{"pressure", "Pressure Class", func(i, j int) int { return compareInts(rows[i].PressureClass, rows[j].PressureClass) }},
+		{"mining", "Mining Difficulty", func(i, j int) int {
+			return compareInts(rows[i].MiningDifficultyBase, rows[j].MiningDifficultyBase)
+		}},
+		{"colonies", "# Colonies", func(i, j int) int { return compareInts(len(rows[i].Colonies), len(rows[j].Colonies)) }},
+		{"ideal_home", "Ideal Home Planet?", func(i, j int) int {
+			return compareBools(rows[i].Is.IdealHomePlanet, rows[j].Is.IdealHomePlanet)
+		}},
+		{"ideal_colony", "Ideal Colony Planet?", func(i, j int) int {
+			return compareBools(rows[i].Is.IdealColonyPlanet, rows[j].Is.IdealColonyPlanet)
+		}},
+		{"hell_hole", "Radioactive Hell Hole?", func(i, j int) int {
+			return compareBools(rows[i].Is.RadioactiveHellHole, rows[j].Is.RadioactiveHellHole)
+		}},
+	}
+	if values.Get("species") != "" || viewer != 0 {
+		columns = append(columns, listColumn{"lsn", "LSN", func(i, j int) int { return compareInts(rows[i].LSN, rows[j].LSN) }})
+	}
+	if values.Get("from") != "" {
+		columns = append(columns, listColumn{"distance", "Distance", func(i, j int) int {
+			return compareFloats(rows[i].Distance, rows[j].Distance)
+		}})
+	}
+	q, err := newListQuery("planets", values, columns)
+	if err != nil {
+		return nil, err
+	}
+	f, err := newSystemFilter(c, q)
+	if err != nil {
+		return nil, err
+	}
+	species, err := q.species(c, "species")
+	if err != nil {
+		return nil, err
+	} else if species == nil && viewer != 0 {
+		species = c.LookupSpecies(viewer)
+	}
+	maxLSN, err := q.optInt("max_lsn")
+	if err != nil {
+		return nil, err
+	} else if maxLSN != nil && species == nil {
+		return nil, fmt.Errorf("max_lsn: requires species")
+	}
+	temp, err := q.optInt("temp")
+	if err != nil {
+		return nil, err
+	}
+	pressure, err := q.optInt("pressure")
+	if err != nil {
+		return nil, err
+	}
+	var flags [4]*bool
+	for i, name := range []string{"ideal_home", "ideal_colony", "hell_hole", "colonized"} {
+		if flags[i], err = q.bool(name); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, planet := range c.Planets {
+		if planet == nil || (planet.System != nil && !f.match(planet.System)) {
+			continue
+		} else if temp != nil && planet.TemperatureClass != *temp {
+			continue
+		} else if pressure != nil && planet.PressureClass != *pressure {
+			continue
+		} else if !matchBool(flags[0], planet.Is.IdealHomePlanet) || !matchBool(flags[1], planet.Is.IdealColonyPlanet) {
+			continue
+		} else if !matchBool(flags[2], planet.Is.RadioactiveHellHole) || !matchBool(flags[3], len(planet.Colonies) != 0) {
+			continue
+		}
+		row := &planetRow{Planet: planet}
+		if species != nil && species.Id-1 < len(planet.LSN) {
+			row.LSN = planet.LSN[species.Id-1]
+		}
+		if maxLSN != nil && row.LSN > *maxLSN {
+			continue
+		}
+		if f.from != nil {
+			row.Distance = distance(*f.from, planet.Coords)
+		}
+		rows = append(rows, row)
+	}
+	q.sortRows(rows)
+	lo, hi := q.bounds(len(rows))
+	return &planetsView{listView: q.view(len(rows)), From: f.from, Species: species, Rows: rows[lo:hi]}, nil
+}
+
+// matchBool returns true if the filter is not set or matches the value.
+func matchBool(filter *bool, value bool) bool {
+	return filter == nil || *filter == value
+}
+
+// speciesView is the data for the species page.
+type speciesView struct {
+	listView
+	Rows []*fhdata.Species
+}
+
+func newSpeciesView(c *fhdata.Cluster, values url.Values) (*speciesView, error) {
+	var rows []*fhdata.Species
+	tech := func(key, label string, level func(sp *fhdata.Species) int) listColumn {
+		return listColumn{key, label, func(i, j int) int { return compareInts(level(rows[i]), level(rows[j])) }}
+	}
+	columns := []listColumn{
+		{"id", "ID", func(i, j int) int { return compareInts(rows[i].Id, rows[j].Id) }},
+		{"name", "Name", func(i, j int) int {
+			return compareStrings(strings.ToLower(rows[i].Name), strings.ToLower(rows[j].Name))
+		}},
+		tech("mi", "MI", func(sp *fhdata.Species) int { return sp.MI.CurrentLevel }),
+		tech("ma", "MA", func(sp *fhdata.Species) int { return sp.MA.CurrentLevel }),
+		tech("ml", "ML", func(sp *fhdata.Species) int { return sp.ML.CurrentLevel }),
+		tech("gv", "GV", func(sp *fhdata.Species) int { return sp.GV.CurrentLevel }),
+		tech("ls", "LS", func(sp *fhdata.Species) int { return sp.LS.CurrentLevel }),
+		tech("bi", "BI", func(sp *fhdata.Species) int { return sp.BI.CurrentLevel }),
+		{"visited", "Systems Visited", func(i, j int) int {
+			return compareInts(len(rows[i].SystemsVisited), len(rows[j].SystemsVisited))
+		}},
+		{"colonies", "Colonies", func(i, j int) int { return compareInts(len(rows[i].Colonies), len(rows[j].Colonies)) }},
+		{"ships", "Ships", func(i, j int) int { return compareInts(len(rows[i].Ships), len(rows[j].Ships)) }},
+		{"production", "Production", func(i, j int) int {
+			return compareInts(rows[i].EconUnitsProduced, rows[j].EconUnitsProduced)
+		}},
+		{"banked", "EUs Banked", func(i, j int) int { return compareInts(rows[i].EconUnitsBanked, rows[j].EconUnitsBanked) }},
+	}
+	q, err := newListQuery("species", values, columns)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(strings.TrimSpace(values.Get("name")))
+
+	for _, species := range c.Species {
+		if species == nil || (name != "" && !strings.Contains(strings.ToLower(species.Name), name)) {
+			continue
+		}
+		rows = append(rows, species)
+	}
+	q.sortRows(rows)
+	lo, hi := q.bounds(len(rows))
+	return &speciesView{listView: q.view(len(rows)), Rows: rows[lo:hi]}, nil
+}
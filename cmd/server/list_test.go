@@ -0,0 +1,297 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"fmt"
+	"github.com/mdhender/fhdata"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newListTestCluster returns a cluster for the list pages: four systems,
+// four planets and three species. From 0,0,0 the systems are 0, 5, 10 and 1
+// parsecs away. Alpha and Gamma tie on colonies and EUs banked so that the
+// sorts can show that they are stable.
+func newListTestCluster() *fhdata.Cluster {
+	alpha := &fhdata.Species{Id: 1, Name: "Alpha", Colonies: make([]*fhdata.Colony, 1), EconUnitsBanked: 100}
+	beta := &fhdata.Species{Id: 2, Name: "Beta", Colonies: make([]*fhdata.Colony, 2), EconUnitsBanked: 50}
+	gamma := &fhdata.Species{Id: 3, Name: "Gamma", Colonies: make([]*fhdata.Colony, 1), EconUnitsBanked: 100}
+
+	yellow, red, white := fhdata.StarColor{Code: "Y", Name: "Yellow"}, fhdata.StarColor{Code: "R", Name: "Red"}, fhdata.StarColor{Code: "W", Name: "White"}
+	s1 := &fhdata.System{Id: 1, Coords: fhdata.Coords{}, Color: yellow,
+		VisitedBy: map[string]*fhdata.Species{"Alpha": alpha}, ScannedBy: map[string]*fhdata.Species{"Alpha": alpha}}
+	s2 := &fhdata.System{Id: 2, Coords: fhdata.Coords{X: 3, Y: 4}, Color: red, VisitedBy: map[string]*fhdata.Species{"Beta": beta}}
+	s3 := &fhdata.System{Id: 3, Coords: fhdata.Coords{X: 10}, Color: yellow}
+	s4 := &fhdata.System{Id: 4, Coords: fhdata.Coords{Z: 1}, Color: white}
+	s1.WormholeExit, s3.WormholeExit = s3, s1
+
+	p1 := &fhdata.Planet{Id: 1, System: s1, Coords: s1.Coords, Orbit: 1, TemperatureClass: 12, PressureClass: 9, LSN: []int{0, 9, 0}, Colonies: make([]*fhdata.Colony, 1)}
+	p1.Is.IdealHomePlanet = true
+	p2 := &fhdata.Planet{Id: 2, System: s1, Coords: s1.Coords, Orbit: 2, TemperatureClass: 3, PressureClass: 0, LSN: []int{6, 3, 0}}
+	p2.Is.RadioactiveHellHole = true
+	p3 := &fhdata.Planet{Id: 3, System: s2, Coords: s2.Coords, Orbit: 1, TemperatureClass: 12, PressureClass: 0, LSN: []int{3, 0, 0}}
+	p3.Is.IdealColonyPlanet = true
+	p4 := &fhdata.Planet{Id: 4, System: s3, Coords: s3.Coords, Orbit: 1, TemperatureClass: 20, PressureClass: 27, LSN: []int{15, 30, 0}}
+	s1.Planets, s2.Planets, s3.Planets = []*fhdata.Planet{p1, p2}, []*fhdata.Planet{p3}, []*fhdata.Planet{p4}
+
+	return &fhdata.Cluster{
+		Systems: []*fhdata.System{s1, s2, s3, s4},
+		Planets: []*fhdata.Planet{p1, p2, p3, p4},
+		Species: []*fhdata.Species{alpha, beta, gamma},
+	}
+}
+
+// rowIds formats the ids of a page's rows for comparing.
+func rowIds(n int, id func(i int) int) string {
+	var ids []string
+	for i := 0; i < n; i++ {
+		ids = append(ids, strconv.Itoa(id(i)))
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestNewListQuery(t *testing.T) {
+	columns := []listColumn{{key: "id"}, {key: "name"}}
+	for _, tc := range []struct {
+		query   string
+		sort    string
+		desc    bool
+		number  int
+		perPage int
+		err     string
+	}{
+		{query: "", sort: "id", number: 1, perPage: defaultPerPage},
+		{query: "sort=name", sort: "name", number: 1, perPage: defaultPerPage},
+		{query: "sort=name&order=asc", sort: "name", number: 1, perPage: defaultPerPage},
+		{query: "order=desc", sort: "id", desc: true, number: 1, perPage: defaultPerPage},
+		{query: "page=3&per_page=25", sort: "id", number: 3, perPage: 25},
+		{query: fmt.Sprintf("per_page=%d", maxPerPage), sort: "id", number: 1, perPage: maxPerPage},
+		{query: fmt.Sprintf("page=%d&per_page=2", math.MaxInt/2+1), sort: "id", number: math.MaxInt/2 + 1, perPage: 2},
+		{query: "sort=size", err: `sort "size": unknown column`},
+		{query: "order=up", err: `order "up": must be asc or desc`},
+		{query: "page=0", err: "page 0: must be at least 1"},
+		{query: "page=-1", err: "page -1: must be at least 1"},
+		{query: "page=two", err: `page "two": must be a number`},
+		{query: "per_page=0", err: "per_page 0: must be 1"},
+		{query: fmt.Sprintf("per_page=%d", maxPerPage+1), err: fmt.Sprintf("per_page %d: must be 1", maxPerPage+1)},
+		{query: fmt.Sprintf("page=%d&per_page=2", math.MaxInt), err: fmt.Sprintf("must be at most %d", math.MaxInt/2+1)},
+		{query: fmt.Sprintf("page=%d&per_page=2", math.MaxInt/2+2), err: "must be at most"},
+	} {
+		values, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := newListQuery("test", values, columns)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: want %q: got %v", tc.query, tc.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: want nil: got %v", tc.query, err)
+			continue
+		}
+		if q.sort.key != tc.sort || q.desc != tc.desc || q.number != tc.number || q.perPage != tc.perPage {
+			t.Errorf("%q: want %s %v %d %d: got %s %v %d %d", tc.query,
+				tc.sort, tc.desc, tc.number, tc.perPage, q.sort.key, q.desc, q.number, q.perPage)
+		}
+	}
+}
+
+func TestSpeciesViewSort(t *testing.T) {
+	c := newListTestCluster()
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"", "1,2,3"},
+		{"order=desc", "3,2,1"},
+		{"sort=name&order=desc", "3,2,1"},
+		// ties stay in id order in both directions
+		{"sort=banked", "2,1,3"},
+		{"sort=banked&order=desc", "1,3,2"},
+		{"sort=colonies", "1,3,2"},
+		{"sort=colonies&order=desc", "2,1,3"},
+		{"name=ET", "2"},
+		{"name=a&sort=banked&order=desc", "1,3,2"},
+	} {
+		values, _ := url.ParseQuery(tc.query)
+		v, err := newSpeciesView(c, values)
+		if err != nil {
+			t.Errorf("%q: want nil: got %v", tc.query, err)
+			continue
+		}
+		if got := rowIds(len(v.Rows), func(i int) int { return v.Rows[i].Id }); got != tc.want {
+			t.Errorf("%q: want %s: got %s", tc.query, tc.want, got)
+		}
+	}
+}
+
+func TestSystemsViewFilters(t *testing.T) {
+	c := newListTestCluster()
+	for _, tc := range []struct {
+		query string
+		want  string
+		err   string
+	}{
+		{query: "", want: "1,2,3,4"},
+		{query: "color=Y", want: "1,3"},
+		{query: "color=red", want: "2"},
+		{query: "wormhole=true", want: "1,3"},
+		{query: "wormhole=false", want: "2,4"},
+		{query: "visited=1", want: "1"},
+		{query: "visited=2", want: "2"},
+		{query: "scanned=1", want: "1"},
+		{query: "scanned=2", want: ""},
+		{query: "from=0,0,0&within=5", want: "1,2,4"},
+		{query: "from=0,0,0&sort=distance", want: "1,4,2,3"},
+		{query: "from=0,0,0&sort=distance&order=desc", want: "3,2,4,1"},
+		{query: "color=yellow&wormhole=true&visited=1", want: "1"},
+		{query: "within=5", err: "within: requires from"},
+		{query: "sort=distance", err: `sort "distance": unknown column`},
+		{query: "wormhole=maybe", err: `wormhole "maybe": must be true or false`},
+		{query: "visited=9", err: "visited 9: no such species"},
+		{query: "from=1,2", err: `from "1,2": must be x,y,z`},
+		{query: "from=0,0,0&within=far", err: `within "far": must be a number`},
+	} {
+		values, _ := url.ParseQuery(tc.query)
+		v, err := newSystemsView(c, values)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: want %q: got %v", tc.query, tc.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: want nil: got %v", tc.query, err)
+			continue
+		}
+		if got := rowIds(len(v.Rows), func(i int) int { return v.Rows[i].Id }); got != tc.want {
+			t.Errorf("%q: want %q: got %q", tc.query, tc.want, got)
+		}
+	}
+}
+
+func TestPlanetsViewFilters(t *testing.T) {
+	c := newListTestCluster()
+	for _, tc := range []struct {
+		query  string
+		viewer int
+		want   string
+		err    string
+	}{
+		{query: "", want: "1,2,3,4"},
+		{query: "temp=12", want: "1,3"},
+		{query: "pressure=0", want: "2,3"},
+		{query: "ideal_home=true", want: "1"},
+		{query: "ideal_home=false", want: "2,3,4"},
+		{query: "ideal_colony=true", want: "3"},
+		{query: "hell_hole=true", want: "2"},
+		{query: "colonized=true", want: "1"},
+		{query: "colonized=false", want: "2,3,4"},
+		{query: "species=1&max_lsn=5", want: "1,3"},
+		{query: "max_lsn=3", viewer: 2, want: "2,3"},
+		{query: "species=1&max_lsn=5", viewer: 2, want: "1,3"},
+		{query: "species=1&sort=lsn&order=desc", want: "4,2,3,1"},
+		{query: "color=yellow", want: "1,2,4"},
+		{query: "from=0,0,0&within=5", want: "1,2,3"},
+		{query: "temp=12&pressure=0", want: "3"},
+		{query: "max_lsn=5", err: "max_lsn: requires species"},
+		{query: "within=5", err: "within: requires from"},
+		{query: "species=9", err: "species 9: no such species"},
+		{query: "temp=hot", err: `temp "hot": must be a number`},
+		{query: "hell_hole=often", err: `hell_hole "often": must be true or false`},
+		{query: "sort=lsn", err: `sort "lsn": unknown column`},
+	} {
+		values, _ := url.ParseQuery(tc.query)
+		v, err := newPlanetsView(c, tc.viewer, values)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: want %q: got %v", tc.query, tc.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: want nil: got %v", tc.query, err)
+			continue
+		}
+		if got := rowIds(len(v.Rows), func(i int) int { return v.Rows[i].Id }); got != tc.want {
+			t.Errorf("%q viewer %d: want %q: got %q", tc.query, tc.viewer, tc.want, got)
+		}
+	}
+}
+
+func TestListPages(t *testing.T) {
+	c := newListTestCluster()
+	for _, tc := range []struct {
+		query       string
+		want        string
+		first, last int
+		pages       int
+		prev, next  bool
+	}{
+		{query: "per_page=3", want: "1,2,3", first: 1, last: 3, pages: 2, next: true},
+		{query: "per_page=3&page=2", want: "4", first: 4, last: 4, pages: 2, prev: true},
+		{query: "per_page=3&page=3", want: "", first: 5, last: 4, pages: 2, prev: true},
+		{query: "per_page=2&page=2&order=desc", want: "2,1", first: 3, last: 4, pages: 2, prev: true},
+		{query: "color=green", want: "", first: 1, last: 0, pages: 1},
+		// the last page that the query accepts is far past the rows, not a panic
+		{query: fmt.Sprintf("per_page=2&page=%d", math.MaxInt/2+1), want: "", first: 5, last: 4, pages: 2, prev: true},
+	} {
+		values, _ := url.ParseQuery(tc.query)
+		v, err := newSystemsView(c, values)
+		if err != nil {
+			t.Errorf("%q: want nil: got %v", tc.query, err)
+			continue
+		}
+		if got := rowIds(len(v.Rows), func(i int) int { return v.Rows[i].Id }); got != tc.want {
+			t.Errorf("%q: want %q: got %q", tc.query, tc.want, got)
+		}
+		if v.First != tc.first || v.Last != tc.last || v.Pages != tc.pages {
+			t.Errorf("%q: want rows %d-%d of %d pages: got %d-%d of %d", tc.query, tc.first, tc.last, tc.pages, v.First, v.Last, v.Pages)
+		}
+		if (v.PrevHref != "") != tc.prev || (v.NextHref != "") != tc.next {
+			t.Errorf("%q: want prev %v next %v: got %q %q", tc.query, tc.prev, tc.next, v.PrevHref, v.NextHref)
+		}
+	}
+
+	// pages past the one whose offset fits in an int are rejected, not sliced
+	for _, name := range []string{"systems", "planets", "species"} {
+		values := url.Values{"page": {strconv.Itoa(math.MaxInt)}, "per_page": {"2"}}
+		var err error
+		switch name {
+		case "systems":
+			_, err = newSystemsView(c, values)
+		case "planets":
+			_, err = newPlanetsView(c, 0, values)
+		case "species":
+			_, err = newSpeciesView(c, values)
+		}
+		if err == nil || !strings.Contains(err.Error(), "must be at most") {
+			t.Errorf("%s: want page error: got %v", name, err)
+		}
+	}
+}
@@ -24,27 +24,86 @@
 package main
 
 import (
-	"encoding/binary"
+	"context"
 	"github.com/mdhender/fhdata"
 	"log"
 	"net"
-	"net/http"
-	"path/filepath"
+	"os"
+	"strconv"
+	"time"
 )
 
 func main() {
-	host, port := "", "9187"
+	cfg, printConfig, err := loadConfig(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if printConfig {
+		if err := cfg.print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	cluster, err := fhdata.LoadFromPath(".", binary.LittleEndian)
+	// the data path may be a single turn (a directory or a turn archive)
+	// or a directory holding one subdirectory or archive per turn
+	layout, _ := cfg.layout()
+	store, err := fhdata.OpenStoreWithLayout(cfg.Data, cfg.CacheTurns, layout)
 	if err != nil {
 		log.Fatal(err)
 	}
+	turns := store.Turns()
+	log.Printf("indexed %d turns, latest is turn %d\n", len(turns), turns[len(turns)-1])
+	logLatest(store)
 
-	s, err := NewServer(host, port, WithStore(cluster), WithTemplates(filepath.Join("..", "templates")))
+	// pick up new turns as the engine writes them
+	if cfg.Watch {
+		go store.Watch(context.Background(), time.Duration(cfg.WatchInterval), time.Duration(cfg.WatchSettle), func(err error) {
+			if err != nil {
+				log.Printf("reload failed, still serving turn %d: %v\n", store.Latest(), err)
+				return
+			}
+			turns := store.Turns()
+			log.Printf("reloaded, indexed %d turns, latest is turn %d\n", len(turns), turns[len(turns)-1])
+			logLatest(store)
+		})
+	}
+
+	options := []Option{
+		WithStore(store),
+		WithSpecies(cfg.Species),
+		WithTemplates(cfg.Templates),
+		WithDevTemplates(cfg.DevTemplates),
+		WithTimeouts(time.Duration(cfg.ReadTimeout), time.Duration(cfg.WriteTimeout)),
+		WithSessionTTL(time.Duration(cfg.SessionTTL)),
+	}
+	// without a credentials file, anyone who can reach the server is the game master
+	if cfg.Credentials != "" {
+		options = append(options, WithCredentials(cfg.Credentials))
+		if cfg.SessionKey != "" {
+			options = append(options, WithSessionKey([]byte(cfg.SessionKey)))
+		}
+	} else {
+		log.Printf("warning: no credentials file, authentication is disabled\n")
+	}
+
+	s, err := NewServer(cfg.Host, strconv.Itoa(cfg.Port), options...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Printf("listening on %q\n", net.JoinHostPort(host, port))
-	log.Fatal(http.ListenAndServe(net.JoinHostPort(host, port), s))
+	log.Printf("listening on %q\n", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+	log.Fatal(s.ListenAndServe())
+}
+
+// logLatest logs the layout of the data files of the latest turn,
+// which the store reads when it indexes the turns.
+func logLatest(store *fhdata.Store) {
+	turn := store.Latest()
+	_, layout, err := store.Load(turn)
+	if err != nil {
+		log.Printf("turn %d: %v\n", turn, err)
+		return
+	}
+	log.Printf("loaded turn %d: %s\n", turn, layout)
 }
@@ -0,0 +1,277 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mdhender/fhdata"
+	"github.com/mdhender/fhdata/templates"
+	"html"
+	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// renderer parses the templates once and executes them for each request.
+// Each page is parsed together with layout.html, which renders the
+// page's "content" block inside the common head and nav.
+type renderer struct {
+	dir  string                                              // optional directory with templates that replace the embedded ones
+	dev  bool                                                // parse the templates again when the files in dir change
+	urls func(name string, params ...string) (string, error) // builds the path of a named route
+
+	mu    sync.Mutex
+	stamp string                        // names and modification times of the files in dir
+	pages map[string]*template.Template // by page name, e.g. "home"
+}
+
+// newRenderer parses the templates. Dev mode watches dir, since the
+// embedded templates can't change, so it needs a directory.
+func newRenderer(dir string, dev bool, urls func(name string, params ...string) (string, error)) (*renderer, error) {
+	if dev && dir == "" {
+		return nil, fmt.Errorf("dev templates: no templates directory to watch")
+	}
+	rd := &renderer{dir: dir, dev: dev, urls: urls}
+	stamp, err := dirStamp(dir)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := rd.parsePages()
+	if err != nil {
+		return nil, err
+	}
+	rd.stamp, rd.pages = stamp, pages
+	return rd, nil
+}
+
+// page returns the parsed template for the page.
+// It must be cloned before it is executed.
+func (rd *renderer) page(name string) (*template.Template, error) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	if rd.dev {
+		stamp, err := dirStamp(rd.dir)
+		if err != nil {
+			return nil, err
+		}
+		if stamp != rd.stamp {
+			// in dev mode, a broken template is reported rather than hidden
+			pages, err := rd.parsePages()
+			if err != nil {
+				return nil, err
+			}
+			rd.stamp, rd.pages = stamp, pages
+		}
+	}
+	t, ok := rd.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("template %q: not found", name)
+	}
+	return t, nil
+}
+
+func (rd *renderer) render(name string, funcs template.FuncMap, data interface{}) ([]byte, error) {
+	t, err := rd.page(name)
+	if err != nil {
+		return nil, err
+	}
+	// the shared template is never executed, so it can always be cloned
+	if t, err = t.Clone(); err != nil {
+		return nil, err
+	}
+	var br bytes.Buffer
+	if err = t.Funcs(funcs).Execute(&br, data); err != nil {
+		return nil, err
+	}
+	return br.Bytes(), nil
+}
+
+// parsePages parses the embedded templates, replacing any that are in dir.
+func (rd *renderer) parsePages() (map[string]*template.Template, error) {
+	dir, funcs := rd.dir, rd.funcs()
+	files := make(map[string][]byte)
+	names, err := fs.Glob(templates.FS, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if files[name], err = fs.ReadFile(templates.FS, name); err != nil {
+			return nil, err
+		}
+	}
+	if dir != "" {
+		if names, err = filepath.Glob(filepath.Join(dir, "*.html")); err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if files[filepath.Base(name)], err = ioutil.ReadFile(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	layout, ok := files["layout.html"]
+	if !ok {
+		return nil, fmt.Errorf("template %q: not found", "layout.html")
+	}
+	pages := make(map[string]*template.Template)
+	for name, text := range files {
+		if name == "layout.html" {
+			continue
+		}
+		t, err := template.New("layout.html").Funcs(funcs).Parse(string(layout))
+		if err != nil {
+			return nil, err
+		}
+		if _, err = t.New(name).Parse(string(text)); err != nil {
+			return nil, err
+		}
+		pages[strings.TrimSuffix(name, ".html")] = t
+	}
+	return pages, nil
+}
+
+// dirStamp returns the names and modification times of the templates in dir.
+func dirStamp(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s@%d;", filepath.Base(name), fi.ModTime().UnixNano())
+	}
+	return sb.String(), nil
+}
+
+// funcs returns the helpers available to every template.
+// base and user depend on the request and are replaced when rendering.
+func (rd *renderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"base":        func() string { return "/" },
+		"user":        func() string { return "" },
+		"comma":       comma,
+		"signed":      signed,
+		"url":         rd.url,
+		"colonyLink":  rd.colonyLink,
+		"planetLink":  rd.planetLink,
+		"shipLink":    rd.shipLink,
+		"speciesLink": rd.speciesLink,
+		"systemLink":  rd.systemLink,
+	}
+}
+
+// url returns the link to a named page, as in {{url "ship" "id" 3 "sid" 14}}.
+// The link is relative to the base, so it stays within the page's turn.
+func (rd *renderer) url(name string, params ...interface{}) (string, error) {
+	values := make([]string, len(params))
+	for i, param := range params {
+		values[i] = fmt.Sprint(param)
+	}
+	p, err := rd.urls(name, values...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(p, "/"), nil
+}
+
+// link returns an anchor for a named page.
+func (rd *renderer) link(text string, name string, params ...interface{}) (template.HTML, error) {
+	href, err := rd.url(name, params...)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), html.EscapeString(text))), nil
+}
+
+// comma formats an integer with thousands separators.
+func comma(n int) string {
+	s := strconv.Itoa(n)
+	start := 0
+	if n < 0 {
+		start = 1
+	}
+	for i := len(s) - 3; i > start; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// signed formats an integer with a leading sign, for changes.
+func signed(n int) string {
+	if n > 0 {
+		return "+" + comma(n)
+	}
+	return comma(n)
+}
+
+func (rd *renderer) colonyLink(c *fhdata.Colony) (template.HTML, error) {
+	if c == nil {
+		return "", nil
+	}
+	return rd.link(c.Name, "colony", "id", c.Species.Id, "cid", c.Id)
+}
+
+func (rd *renderer) planetLink(p *fhdata.Planet) (template.HTML, error) {
+	if p == nil {
+		return "", nil
+	}
+	return rd.link(fmt.Sprintf("%s #%d", p.Coords, p.Orbit), "planet", "id", p.Id)
+}
+
+func (rd *renderer) shipLink(s *fhdata.Ship) (template.HTML, error) {
+	if s == nil {
+		return "", nil
+	}
+	return rd.link(s.Name, "ship", "id", s.Species.Id, "sid", s.Id)
+}
+
+func (rd *renderer) speciesLink(sp *fhdata.Species) (template.HTML, error) {
+	if sp == nil {
+		return "", nil
+	}
+	return rd.link(sp.Name, "specie", "id", sp.Id)
+}
+
+func (rd *renderer) systemLink(s *fhdata.System) (template.HTML, error) {
+	if s == nil {
+		return "", nil
+	}
+	return rd.link(s.Coords.String(), "system", "id", s.Id)
+}
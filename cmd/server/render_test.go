@@ -0,0 +1,167 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComma(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		want string
+	}{
+		{0, "0"},
+		{7, "7"},
+		{999, "999"},
+		{1000, "1,000"},
+		{123456, "123,456"},
+		{1234567, "1,234,567"},
+		{-7, "-7"},
+		{-999, "-999"},
+		{-1000, "-1,000"},
+		{-123456, "-123,456"},
+		{-1234567, "-1,234,567"},
+	} {
+		if got := comma(tc.n); got != tc.want {
+			t.Errorf("comma(%d): want %q: got %q", tc.n, tc.want, got)
+		}
+	}
+}
+
+func TestSigned(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		want string
+	}{
+		{0, "0"},
+		{1, "+1"},
+		{1500, "+1,500"},
+		{-1, "-1"},
+		{-1500, "-1,500"},
+	} {
+		if got := signed(tc.n); got != tc.want {
+			t.Errorf("signed(%d): want %q: got %q", tc.n, tc.want, got)
+		}
+	}
+}
+
+// testURLs stands in for the router's named routes.
+func testURLs(name string, params ...string) (string, error) {
+	return "/" + strings.Join(append([]string{name}, params...), "/"), nil
+}
+
+// renderPage renders a page with no data and returns the body.
+func renderPage(t *testing.T, rd *renderer, name string) string {
+	t.Helper()
+	b, err := rd.render(name, template.FuncMap{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRendererOverride(t *testing.T) {
+	dir := t.TempDir()
+	login := filepath.Join(dir, "login.html")
+	if err := ioutil.WriteFile(login, []byte(`{{define "content"}}<p>replaced login</p>{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rd, err := newRenderer(dir, false, testURLs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the file in the directory takes priority over the embedded template
+	if got := renderPage(t, rd, "login"); !strings.Contains(got, "<p>replaced login</p>") || strings.Contains(got, "<form") {
+		t.Errorf("login: want the replacement: got %s", got)
+	}
+	// the replacement is still rendered inside the embedded layout
+	if got := renderPage(t, rd, "login"); !strings.Contains(got, `<a href="home">Home</a>`) {
+		t.Errorf("login: want the embedded layout: got %s", got)
+	}
+	// and pages that are not in the directory are still embedded
+	if _, err := rd.page("home"); err != nil {
+		t.Errorf("home: want the embedded page: got %v", err)
+	}
+
+	// without dev mode, changes are not picked up
+	if err := ioutil.WriteFile(login, []byte(`{{define "content"}}<p>changed login</p>{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(login, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := renderPage(t, rd, "login"); !strings.Contains(got, "<p>replaced login</p>") {
+		t.Errorf("login: want the replacement from startup: got %s", got)
+	}
+}
+
+func TestRendererDev(t *testing.T) {
+	if _, err := newRenderer("", true, testURLs); err == nil {
+		t.Fatal("dev mode without a directory: want an error")
+	}
+
+	dir := t.TempDir()
+	login := filepath.Join(dir, "login.html")
+	rd, err := newRenderer(dir, true, testURLs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := renderPage(t, rd, "login"); !strings.Contains(got, "<form") {
+		t.Errorf("login: want the embedded page: got %s", got)
+	}
+
+	// a new file replaces the embedded page, and a change to it is picked up
+	for i, text := range []string{"first", "second"} {
+		if err := ioutil.WriteFile(login, []byte(`{{define "content"}}<p>`+text+`</p>{{end}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(time.Duration(i+1) * time.Hour)
+		if err := os.Chtimes(login, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if got := renderPage(t, rd, "login"); !strings.Contains(got, "<p>"+text+"</p>") {
+			t.Errorf("login: want the %s version: got %s", text, got)
+		}
+	}
+
+	// a broken template is reported, not hidden
+	if err := ioutil.WriteFile(login, []byte(`{{define "content"}}{{end`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(3 * time.Hour)
+	if err := os.Chtimes(login, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rd.render("login", template.FuncMap{}, nil); err == nil {
+		t.Error("broken login: want an error")
+	}
+}
@@ -24,7 +24,10 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"github.com/mdhender/fhdata"
 	"github.com/mdhender/fhdata/internal/way"
 	"html/template"
@@ -32,13 +35,14 @@ import (
 	"net"
 	"net/http"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"time"
 )
 
-func NewServer(host, port string, opts ...func(*Server) error) (*Server, error) {
+func NewServer(host, port string, opts ...Option) (*Server, error) {
 	s := &Server{
-		router: way.NewRouter(),
+		router:     way.NewRouter(),
+		sessionTTL: 24 * time.Hour,
 	}
 	s.Addr = net.JoinHostPort(host, port)
 	s.ReadTimeout = 5 * time.Second
@@ -52,27 +56,102 @@ func NewServer(host, port string, opts ...func(*Server) error) (*Server, error)
 		}
 	}
 
+	if s.store == nil {
+		return nil, fmt.Errorf("missing store")
+	}
+	var err error
+	if s.renderer, err = newRenderer(s.templates, s.devTemplates, s.router.URL); err != nil {
+		return nil, err
+	}
+	// species are checked against the latest turn, since new species
+	// may not exist in the earlier ones
+	latest, _, err := s.store.Load(s.store.Latest())
+	if err != nil {
+		return nil, err
+	}
+	// a server for a single species only ever sees that species' view
+	if s.species != 0 && latest.LookupSpecies(s.species) == nil {
+		return nil, fmt.Errorf("species %d: not in cluster", s.species)
+	}
+	for _, acct := range s.accounts {
+		if acct.Species != 0 && latest.LookupSpecies(acct.Species) == nil {
+			return nil, fmt.Errorf("account %q: species %d: not in cluster", acct.Name, acct.Species)
+		}
+	}
+	if s.accounts != nil && s.sessionKey == nil {
+		// sessions will not survive a restart
+		s.sessionKey = make([]byte, 32)
+		if _, err := rand.Read(s.sessionKey); err != nil {
+			return nil, err
+		}
+	}
+
 	s.router.HandleFunc("GET", "/manifest.json", s.manifestJsonV3)
-	s.router.HandleFunc("GET", "/home", s.getHome())
-	s.router.HandleFunc("GET", "/planets", s.getPlanets())
-	s.router.HandleFunc("GET", "/planet/:id", s.getPlanet())
-	s.router.HandleFunc("GET", "/species", s.getSpecies())
-	s.router.HandleFunc("GET", "/specie/:id", s.getSpecie())
-	s.router.HandleFunc("GET", "/specie/:id/ship/:sid", s.getSpecieShip())
-	s.router.HandleFunc("GET", "/systems", s.getSystems())
-	s.router.HandleFunc("GET", "/system/:id", s.getSystem())
-	s.router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-	})
+	s.router.HandleFunc("GET", "/login", s.getLogin())
+	s.router.HandleFunc("POST", "/login", s.postLogin())
+	s.router.HandleFunc("GET", "/logout", s.getLogout())
+	s.router.HandleFunc("GET", "/turns", s.getTurns())
+	s.router.HandleFunc("GET", "/api/v1/turns", s.apiGetTurns())
+	// every page is served for the latest turn and for a given turn
+	for _, prefix := range []string{"/api/v1", "/api/v1/turns/:n{int}"} {
+		s.router.Group(prefix, func(g *way.Group) {
+			g.Use(s.withTurn)
+			g.HandleFunc("GET", "/planets", s.apiGetPlanets())
+			g.HandleFunc("GET", "/planets/:id{int}", s.apiGetPlanet())
+			g.HandleFunc("GET", "/species", s.apiGetSpecies())
+			g.HandleFunc("GET", "/species/:id{int}", s.apiGetSpecie())
+			g.HandleFunc("GET", "/species/:id{int}/colonies", s.apiGetSpecieColonies())
+			g.HandleFunc("GET", "/species/:id{int}/colonies/:cid{int}", s.apiGetSpecieColony())
+			g.HandleFunc("GET", "/species/:id{int}/ships", s.apiGetSpecieShips())
+			g.HandleFunc("GET", "/species/:id{int}/ships/:sid{int}", s.apiGetSpecieShip())
+			g.HandleFunc("GET", "/systems", s.apiGetSystems())
+			g.HandleFunc("GET", "/systems/:id{int}", s.apiGetSystem())
+		})
+	}
+	for _, prefix := range []string{"", "/turn/:n{int}"} {
+		latest := prefix == ""
+		s.router.Group(prefix, func(g *way.Group) {
+			g.Use(s.withTurn)
+			// only the latest turn's pages are named, since the templates
+			// link relative to the page's turn
+			page := func(name, pattern string, handler http.HandlerFunc) {
+				if route := g.HandleFunc("GET", pattern, handler); latest {
+					route.Name(name)
+				}
+			}
+			page("home", "/home", s.getHome())
+			page("planets", "/planets", s.getPlanets())
+			page("planet", "/planet/:id{int}", s.getPlanet())
+			page("species", "/species", s.getSpecies())
+			page("specie", "/specie/:id{int}", s.getSpecie())
+			page("colony", "/specie/:id{int}/colony/:cid{int}", s.getSpecieColony())
+			page("maintenance", "/specie/:id{int}/maintenance", s.getSpecieMaintenance())
+			page("ship", "/specie/:id{int}/ship/:sid{int}", s.getSpecieShip())
+			page("systems", "/systems", s.getSystems())
+			page("system", "/system/:id{int}", s.getSystem())
+		})
+	}
+	s.router.NotFound = http.HandlerFunc(s.notFound)
+	s.router.MethodNotAllowed = http.HandlerFunc(s.methodNotAllowed)
+	// every page has one URL, so caches don't hold duplicates
+	s.router.RedirectCode = http.StatusPermanentRedirect
+	s.router.Use(s.authenticate)
+	s.Handler = s.router
 
 	return s, nil
 }
 
 type Server struct {
 	http.Server
-	router    *way.Router
-	templates string // path to templates directory
-	data      *fhdata.Cluster
+	router       *way.Router
+	templates    string // optional directory with templates that replace the embedded ones
+	devTemplates bool   // parse the templates again when they change
+	renderer     *renderer
+	store        *fhdata.Store
+	species      int                 // id of the species the server is restricted to, 0 for none
+	accounts     map[string]*account // nil when authentication is disabled
+	sessionKey   []byte              // signs the session cookies
+	sessionTTL   time.Duration
 }
 
 type Option func(*Server) error
@@ -89,20 +168,159 @@ func Options(opts ...Option) Option {
 	}
 }
 
-func WithStore(store *fhdata.Cluster) Option {
+func WithStore(store *fhdata.Store) Option {
+	return func(s *Server) (err error) {
+		s.store = store
+		return nil
+	}
+}
+
+// WithCredentials requires every caller to log in with an account
+// from the credentials file.
+func WithCredentials(name string) Option {
+	return func(s *Server) (err error) {
+		s.accounts, err = loadCredentials(name)
+		return err
+	}
+}
+
+// WithSessionKey sets the key that signs session cookies.
+// Without it, a random key is used and sessions end on restart.
+func WithSessionKey(key []byte) Option {
+	return func(s *Server) (err error) {
+		if len(key) < 32 {
+			return fmt.Errorf("session key: want at least 32 bytes, got %d", len(key))
+		}
+		s.sessionKey = key
+		return nil
+	}
+}
+
+func WithSessionTTL(ttl time.Duration) Option {
+	return func(s *Server) (err error) {
+		if ttl <= 0 {
+			return fmt.Errorf("session ttl: must be positive")
+		}
+		s.sessionTTL = ttl
+		return nil
+	}
+}
+
+// WithSpecies restricts the server to the fog-of-war view of a
+// single species. Zero means the game master's view of everything.
+func WithSpecies(id int) Option {
 	return func(s *Server) (err error) {
-		s.data = store
+		if id < 0 || id > fhdata.MAX_SPECIES {
+			return fmt.Errorf("species %d: out of range", id)
+		}
+		s.species = id
+		return nil
+	}
+}
+
+// WithTimeouts sets the maximum durations for reading a request and
+// writing a response.
+func WithTimeouts(read, write time.Duration) Option {
+	return func(s *Server) (err error) {
+		if read <= 0 || write <= 0 {
+			return fmt.Errorf("timeouts: must be positive")
+		}
+		s.ReadTimeout, s.WriteTimeout = read, write
 		return nil
 	}
 }
 
+// WithTemplates sets a directory of templates that replace the
+// embedded templates with the same names.
 func WithTemplates(root string) Option {
 	return func(s *Server) (err error) {
-		s.templates = filepath.Clean(root)
+		if root != "" {
+			root = filepath.Clean(root)
+		}
+		s.templates = root
 		return nil
 	}
 }
 
+// WithDevTemplates parses the templates again whenever the files in the
+// templates directory change, for working on them without restarting.
+// It needs WithTemplates; NewServer fails without a directory to watch.
+func WithDevTemplates(dev bool) Option {
+	return func(s *Server) (err error) {
+		s.devTemplates = dev
+		return nil
+	}
+}
+
+// turnContext is the turn selected by the request.
+type turnContext struct {
+	base    string          // prefix for links within the turn
+	cluster *fhdata.Cluster // the turn as the caller is allowed to see it
+}
+
+const turnContextKey = contextKey("turn")
+
+// withTurn loads the turn named by the ":n" parameter, or the latest
+// turn if there is none, and stores it in the request context.
+func (s *Server) withTurn(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		turn, base := s.store.Latest(), "/"
+		if way.Param(r.Context(), "n") != "" {
+			var err error
+			if turn, err = way.ParamInt(r.Context(), "n"); err != nil {
+				s.notFound(w, r)
+				return
+			}
+			base = fmt.Sprintf("/turn/%d/", turn)
+		}
+		cluster, err := s.store.View(turn, s.viewer(r))
+		if errors.Is(err, fhdata.ErrNoSuchTurn) || errors.Is(err, fhdata.ErrNoSuchSpecies) {
+			s.notFound(w, r)
+			return
+		} else if err != nil {
+			log.Printf("withTurn: %s %s: %+v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), turnContextKey, &turnContext{base: base, cluster: cluster})))
+	})
+}
+
+// cluster returns the cluster the request is allowed to see.
+func (s *Server) cluster(r *http.Request) *fhdata.Cluster {
+	return r.Context().Value(turnContextKey).(*turnContext).cluster
+}
+
+// notFound writes a JSON error for the api and plain text for pages.
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		apiError(w, http.StatusNotFound)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+}
+
+// methodNotAllowed is like notFound, for paths whose routes are for other methods.
+func (s *Server) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		apiError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// viewer returns the id of the species the request is restricted to,
+// or zero for the game master.
+func (s *Server) viewer(r *http.Request) int {
+	if s.species != 0 {
+		return s.species
+	}
+	if sess := sessionFrom(r.Context()); sess != nil {
+		return sess.Species
+	}
+	return 0
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
@@ -110,7 +328,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (s *Server) getHome() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("getHome: %s %s\n", r.Method, r.URL.Path)
-		b, err := s.render("home", s.data)
+		b, err := s.render(r, "home", s.cluster(r))
 		if err != nil {
 			log.Printf("getHome: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -124,14 +342,14 @@ func (s *Server) getHome() http.HandlerFunc {
 func (s *Server) getPlanet() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("getPlanet: %s %s\n", r.Method, r.URL.Path)
-		id, err := strconv.Atoi(way.Param(r.Context(), "id"))
-		if err != nil || !(0 < id && id <= len(s.data.Planets)) {
+		id, err := way.ParamInt(r.Context(), "id")
+		planet := s.cluster(r).LookupPlanet(id)
+		if err != nil || planet == nil {
 			//log.Printf("getPlanet: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 			return
 		}
-		planet := s.data.Planets[id-1]
-		b, err := s.render("planet", planet)
+		b, err := s.render(r, "planet", planet)
 		if err != nil {
 			log.Printf("getPlanet: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -145,7 +363,13 @@ func (s *Server) getPlanet() http.HandlerFunc {
 func (s *Server) getPlanets() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("getPlanets: %s %s\n", r.Method, r.URL.Path)
-		b, err := s.render("planets", s.data)
+		v, err := newPlanetsView(s.cluster(r), s.viewer(r), r.URL.Query())
+		if err != nil {
+			log.Printf("getPlanets: %s %s: %+v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := s.render(r, "planets", v)
 		if err != nil {
 			log.Printf("getPlanets: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -159,15 +383,14 @@ func (s *Server) getPlanets() http.HandlerFunc {
 func (s *Server) getSpecie() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("getSpecie: %s %s\n", r.Method, r.URL.Path)
-		id, err := strconv.Atoi(way.Param(r.Context(), "id"))
-		if err != nil || !(0 < id && id <= len(s.data.Species)) {
+		id, err := way.ParamInt(r.Context(), "id")
+		specie := s.cluster(r).LookupSpecies(id)
+		if err != nil || specie == nil {
 			log.Printf("getSpecie: %s %s: %+v\n", r.Method, r.URL.Path, err)
-			log.Printf("getSpecie: %s %s: len(s.data.Species) %d id %q\n", r.Method, r.URL.Path, len(s.data.Species), way.Param(r.Context(), "id"))
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 			return
 		}
-		specie := s.data.Species[id-1]
-		b, err := s.render("specie", specie)
+		b, err := s.render(r, "specie", specie)
 		if err != nil {
 			log.Printf("getSpecie: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -178,24 +401,77 @@ func (s *Server) getSpecie() http.HandlerFunc {
 	}
 }
 
+func (s *Server) getSpecieColony() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("getSpecieColony: %s %s\n", r.Method, r.URL.Path)
+		id, err := way.ParamInt(r.Context(), "id")
+		specie := s.cluster(r).LookupSpecies(id)
+		if err != nil || specie == nil {
+			log.Printf("getSpecieColony: %s %s: %+v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		colonyId, err := way.ParamInt(r.Context(), "cid")
+		colony := specie.LookupColony(colonyId)
+		if err != nil || colony == nil {
+			log.Printf("getSpecieColony: %s %s: %+v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		b, err := s.render(r, "colony", s.newColonyView(s.cluster(r), colony))
+		if err != nil {
+			log.Printf("getSpecieColony: %s %s: %+v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(b)
+	}
+}
+
+func (s *Server) getSpecieMaintenance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("getSpecieMaintenance: %s %s\n", r.Method, r.URL.Path)
+		id, err := way.ParamInt(r.Context(), "id")
+		specie := s.cluster(r).LookupSpecies(id)
+		if viewer := s.viewer(r); viewer != 0 && id != viewer {
+			// only the owner knows the upkeep of its fleet
+			specie = nil
+		}
+		if err != nil || specie == nil {
+			log.Printf("getSpecieMaintenance: %s %s: %+v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		b, err := s.render(r, "maintenance", fhdata.ReconcileFleetMaintenance(specie))
+		if err != nil {
+			log.Printf("getSpecieMaintenance: %s %s: %+v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(b)
+	}
+}
+
 func (s *Server) getSpecieShip() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("getSpecieShip: %s %s\n", r.Method, r.URL.Path)
-		id, err := strconv.Atoi(way.Param(r.Context(), "id"))
-		if err != nil || !(0 < id && id <= len(s.data.Species)) {
+		id, err := way.ParamInt(r.Context(), "id")
+		specie := s.cluster(r).LookupSpecies(id)
+		if err != nil || specie == nil {
 			log.Printf("getSpecie: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 			return
 		}
-		specie := s.data.Species[id-1]
-		shipId, err := strconv.Atoi(way.Param(r.Context(), "sid"))
-		if err != nil || !(0 < shipId && shipId <= len(specie.Ships)) {
+		shipId, err := way.ParamInt(r.Context(), "sid")
+		ship := specie.LookupShip(shipId)
+		if err != nil || ship == nil {
 			log.Printf("getSpecieShip: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 			return
 		}
-		ship := specie.Ships[shipId-1]
-		b, err := s.render("ship", ship)
+		b, err := s.render(r, "ship", ship)
 		if err != nil {
 			log.Printf("getSpecieShip: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -209,9 +485,33 @@ func (s *Server) getSpecieShip() http.HandlerFunc {
 func (s *Server) getSpecies() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("getSpecies: %s %s\n", r.Method, r.URL.Path)
-		b, err := s.render("species", s.data)
+		v, err := newSpeciesView(s.cluster(r), r.URL.Query())
 		if err != nil {
 			log.Printf("getSpecies: %s %s: %+v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := s.render(r, "species", v)
+		if err != nil {
+			log.Printf("getSpecies: %s %s: %+v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(b)
+	}
+}
+
+func (s *Server) getTurns() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("getTurns: %s %s\n", r.Method, r.URL.Path)
+		turns := s.store.Turns()
+		b, err := s.render(r, "turns", struct {
+			Latest int
+			Turns  []int
+		}{Latest: turns[len(turns)-1], Turns: turns})
+		if err != nil {
+			log.Printf("getTurns: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
@@ -223,14 +523,14 @@ func (s *Server) getSpecies() http.HandlerFunc {
 func (s *Server) getSystem() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("getSystem: %s %s\n", r.Method, r.URL.Path)
-		id, err := strconv.Atoi(way.Param(r.Context(), "id"))
-		if err != nil || !(0 < id && id <= len(s.data.Systems)) {
+		id, err := way.ParamInt(r.Context(), "id")
+		system := s.cluster(r).LookupSystem(id)
+		if err != nil || system == nil {
 			//log.Printf("getSystem: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 			return
 		}
-		system := s.data.Systems[id-1]
-		b, err := s.render("system", system)
+		b, err := s.render(r, "system", system)
 		if err != nil {
 			log.Printf("getSystem: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -244,7 +544,13 @@ func (s *Server) getSystem() http.HandlerFunc {
 func (s *Server) getSystems() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("getSystems: %s %s\n", r.Method, r.URL.Path)
-		b, err := s.render("systems", s.data)
+		v, err := newSystemsView(s.cluster(r), r.URL.Query())
+		if err != nil {
+			log.Printf("getSystems: %s %s: %+v\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := s.render(r, "systems", v)
 		if err != nil {
 			log.Printf("getSystems: %s %s: %+v\n", r.Method, r.URL.Path, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -264,14 +570,51 @@ func (s *Server) manifestJsonV3(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(`{"manifest_version":3,"name":"My Extension","version":"versionString"}`))
 }
 
-func (s *Server) render(name string, data interface{}) ([]byte, error) {
-	t, err := template.ParseFiles(filepath.Join(s.templates, name+".html"))
-	if err != nil {
-		return nil, err
+// colonyView is the data for the colony page.
+type colonyView struct {
+	*fhdata.Colony
+	InventoryCargo int
+	InventoryCost  int
+	Neighbors      []*fhdata.Colony // colonies of other species on the same planet
+	Ships          []*fhdata.Ship   // ships of any species in orbit or on the surface
+}
+
+func (s *Server) newColonyView(c *fhdata.Cluster, colony *fhdata.Colony) *colonyView {
+	v := &colonyView{Colony: colony}
+	for _, item := range colony.Inventory {
+		v.InventoryCargo += item.Cargo
+		v.InventoryCost += item.Cost
 	}
-	var br bytes.Buffer
-	if err = t.Execute(&br, data); err != nil {
-		return nil, err
+	if colony.Planet == nil {
+		return v
+	}
+	for _, neighbor := range colony.Planet.Colonies {
+		if neighbor.Species != colony.Species {
+			v.Neighbors = append(v.Neighbors, neighbor)
+		}
+	}
+	for _, specie := range c.Species {
+		for _, ship := range specie.Ships {
+			if ship.Location.Planet == colony.Planet && (ship.InOrbit || ship.OnSurface) {
+				v.Ships = append(v.Ships, ship)
+			}
+		}
+	}
+	return v
+}
+
+func (s *Server) render(r *http.Request, name string, data interface{}) ([]byte, error) {
+	// base is the prefix for links, so that pages for an earlier turn link to the same turn
+	base := "/"
+	if tc, ok := r.Context().Value(turnContextKey).(*turnContext); ok {
+		base = tc.base
+	}
+	user := ""
+	if sess := sessionFrom(r.Context()); sess != nil {
+		user = sess.Name
 	}
-	return br.Bytes(), nil
+	return s.renderer.render(name, template.FuncMap{
+		"base": func() string { return base },
+		"user": func() string { return user },
+	}, data)
 }
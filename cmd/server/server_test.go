@@ -0,0 +1,188 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mdhender/fhdata"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestTurn returns a turn with three systems, one planet in each and
+// two species. Alpha lives in system 1 and has a scout in Beta's home,
+// system 2, so it sees Beta's home colony and ship. Alpha also has a
+// colony in deep space, which is not linked to a system or planet.
+// Beta's outpost in system 3 is out of Alpha's sight. Alpha has
+// contacted Beta, but not the other way around.
+func newTestTurn(turn int) *fhdata.Cluster {
+	yellow, mainSequence := fhdata.StarColor{Code: "G", Name: "Yellow"}, fhdata.StarType{Code: " ", Name: "Main Sequence"}
+	s1 := &fhdata.System{Id: 1, Coords: fhdata.Coords{X: 1, Y: 1, Z: 1}, Color: yellow, Type: mainSequence, Size: 5}
+	s2 := &fhdata.System{Id: 2, Coords: fhdata.Coords{X: 5, Y: 5, Z: 5}, Color: yellow, Type: mainSequence, Size: 3}
+	s3 := &fhdata.System{Id: 3, Coords: fhdata.Coords{X: 9, Y: 9, Z: 9}, Color: yellow, Type: mainSequence, Size: 7}
+	s1.Is.HomeSystem, s2.Is.HomeSystem = true, true
+
+	oxygen := fhdata.Gas{Code: "O2", Name: "Oxygen"}
+	var planets []*fhdata.Planet
+	for _, system := range []*fhdata.System{s1, s2, s3} {
+		planet := &fhdata.Planet{Id: system.Id, System: system, Coords: system.Coords, Orbit: 1,
+			Atmosphere: []*fhdata.AtmosphericGas{{Gas: oxygen, Pct: 30}},
+			Diameter:   12, Gravity: 100, EconEfficiency: 100, MiningDifficultyBase: 200, TemperatureClass: 12, PressureClass: 9}
+		system.Planets = []*fhdata.Planet{planet}
+		planets = append(planets, planet)
+	}
+
+	alpha := &fhdata.Species{Id: 1, Name: "Alpha", GovtName: "Council", GovtType: "Democracy",
+		HomePlanet: planets[0], EconUnitsBanked: 100 * turn, FleetMaintenanceCost: 7,
+		Contacts: make(map[string]*fhdata.Species)}
+	beta := &fhdata.Species{Id: 2, Name: "Beta", GovtName: "Hive", GovtType: "Monarchy",
+		HomePlanet: planets[1], EconUnitsBanked: 555}
+	for _, species := range []*fhdata.Species{alpha, beta} {
+		species.Gases.Required.Gas, species.Gases.Required.MinPct, species.Gases.Required.MaxPct = oxygen, 10, 50
+		species.MI, species.MA, species.ML = fhdata.Tech{CurrentLevel: 10}, fhdata.Tech{CurrentLevel: 10}, fhdata.Tech{CurrentLevel: 10}
+	}
+	alpha.Contacts["Beta"] = beta
+	s1.VisitedBy = map[string]*fhdata.Species{"Alpha": alpha}
+	s2.VisitedBy = map[string]*fhdata.Species{"Alpha": alpha, "Beta": beta}
+	s3.VisitedBy = map[string]*fhdata.Species{"Beta": beta}
+
+	colony := func(species *fhdata.Species, name string, planet *fhdata.Planet, status int) *fhdata.Colony {
+		c := &fhdata.Colony{Id: len(species.Colonies) + 1, Name: name, Species: species, Planet: planet, System: planet.System,
+			Coords: planet.Coords, Orbit: planet.Orbit, Status: status, PopulationUnits: 50, MiningBase: 300, ManufacturingBase: 400,
+			Inventory: []fhdata.Item{{Code: "IU", Quantity: 20}}}
+		species.Colonies = append(species.Colonies, c)
+		return c
+	}
+	colony(alpha, "Home", planets[0], fhdata.HOME_PLANET|fhdata.POPULATED)
+	drifter := colony(alpha, "Drifter", planets[0], fhdata.COLONY)
+	drifter.Planet, drifter.System, drifter.Coords = nil, nil, fhdata.Coords{X: 2, Y: 2, Z: 2}
+	colony(beta, "Nest", planets[1], fhdata.HOME_PLANET|fhdata.POPULATED)
+	colony(beta, "Outpost", planets[2], fhdata.COLONY|fhdata.MINING_COLONY)
+
+	ship := func(species *fhdata.Species, name, class string, system *fhdata.System) {
+		species.Ships = append(species.Ships, &fhdata.Ship{Id: len(species.Ships) + 1, Name: name, Species: species, Class: class,
+			Coords: system.Coords, Orbit: 1, Status: fhdata.IN_ORBIT, Tonnage: 10_000, Age: 2,
+			Inventory: []fhdata.Item{{Code: "CU", Quantity: 1}}})
+	}
+	ship(alpha, "Scout", "PB", s2)
+	ship(beta, "Drone", "FF", s2)
+
+	return &fhdata.Cluster{Turn: turn, Radius: 20, DesignedNumSpecies: 2,
+		Systems: []*fhdata.System{s1, s2, s3},
+		Planets: planets,
+		Species: []*fhdata.Species{alpha, beta},
+	}
+}
+
+// openTestStore saves the turns from newTestTurn and opens a store of them.
+func openTestStore(t *testing.T, turns ...int) *fhdata.Store {
+	t.Helper()
+	root := t.TempDir()
+	for _, turn := range turns {
+		dir := filepath.Join(root, fmt.Sprintf("t%d", turn))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		} else if err := fhdata.SaveToPath(dir, binary.LittleEndian, newTestTurn(turn)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := fhdata.OpenStore(root, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// testSessionKey signs the session cookies of servers with accounts.
+var testSessionKey = []byte("0123456789abcdef0123456789abcdef")
+
+// newTestServer returns a server for turns 1 and 2.
+// With accounts, it has a game master "gm" and "alpha" for species 1.
+func newTestServer(t *testing.T, accounts bool, opts ...Option) *Server {
+	t.Helper()
+	opts = append([]Option{WithStore(openTestStore(t, 1, 2))}, opts...)
+	if accounts {
+		hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(t.TempDir(), "credentials")
+		if err := os.WriteFile(name, []byte(fmt.Sprintf("gm:gm:%s\nalpha:1:%s\n", hash, hash)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, WithCredentials(name), WithSessionKey(testSessionKey))
+	}
+	s, err := NewServer("localhost", "0", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// get serves a GET request, with a session cookie for the account if
+// the name is not empty.
+func get(s *Server, path, account string, species int) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", path, nil)
+	if account != "" {
+		sess := &session{Name: account, Species: species, Expires: time.Now().Add(time.Hour)}
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: sess.encode(testSessionKey)})
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestColonyPages(t *testing.T) {
+	s := newTestServer(t, false)
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		// a colony on a planet links to its system and planet
+		{path: "/specie/1/colony/1", want: []string{`<a href="system/1">1, 1, 1</a>`, `<a href="planet/1">#1</a>`}},
+		// a colony in deep space has no system or planet to link to
+		{path: "/specie/1/colony/2", want: []string{"<td>2, 2, 2</td>", `<td align="right">#1</td>`, "No other species have colonies on this planet."}},
+		{path: "/turn/1/specie/1/colony/2", want: []string{"<td>2, 2, 2</td>"}},
+		// the species page lists both
+		{path: "/specie/1", want: []string{`<a href="system/1">1, 1, 1</a>`, "<td>2, 2, 2</td>", `<td align="right">#1</td>`}},
+	} {
+		w := get(s, tc.path, "", 0)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: want 200: got %d: %s", tc.path, w.Code, w.Body.String())
+			continue
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("%s: want %q", tc.path, want)
+			}
+		}
+	}
+}
@@ -25,29 +25,97 @@ package fhdata
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
 )
 
 // LoadFromPath loads the galaxy, stars, planets, and species files from the given path.
+// The files must have the byte order given and the record sizes of the Go structs.
 func LoadFromPath(dataPath string, bo binary.ByteOrder) (*Cluster, error) {
+	return LoadFromPathWithLayout(dataPath, NewLayout(bo))
+}
+
+// LoadFromPathAuto detects the layout of the files in the given path and then loads them.
+// It returns the layout that was detected along with the cluster.
+func LoadFromPathAuto(dataPath string) (*Cluster, *Layout, error) {
+	cluster, layout, err := LoadFromFSAuto(os.DirFS(dataPath))
+	if err != nil {
+		return nil, nil, withDataPath(dataPath, err)
+	}
+	return cluster, layout, nil
+}
+
+// LoadFromPathWithLayout loads the galaxy, stars, planets, and species files from the given path.
+func LoadFromPathWithLayout(dataPath string, layout *Layout) (*Cluster, error) {
+	cluster, err := LoadFromFS(os.DirFS(dataPath), layout)
+	if err != nil {
+		return nil, withDataPath(dataPath, err)
+	}
+	return cluster, nil
+}
+
+// LoadFromFSAuto detects the layout of the files in the file system and then loads them.
+// It returns the layout that was detected along with the cluster.
+func LoadFromFSAuto(fsys fs.FS) (*Cluster, *Layout, error) {
+	layout, err := DetectLayoutFS(fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+	cluster, err := LoadFromFS(fsys, layout)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cluster, layout, nil
+}
+
+// LoadFromFS loads the galaxy, stars, planets, and species files from the root of the file system.
+func LoadFromFS(fsys fs.FS, layout *Layout) (*Cluster, error) {
 	// load the galaxy, stars, planets, and species data from the binary files.
-	galaxy, err := readGalaxy(filepath.Join(dataPath, "galaxy.dat"), bo)
+	galaxy, err := readGalaxy(fsys, "galaxy.dat", layout.ByteOrder)
 	if err != nil {
 		return nil, err
 	}
-	stars, err := readStars(filepath.Join(dataPath, "stars.dat"), bo)
+	if !(0 <= galaxy.NumSpecies && galaxy.NumSpecies <= MAX_SPECIES) {
+		return nil, &DataError{File: "galaxy.dat", Record: "galaxy_data", Index: 0, Offset: 4, Err: fmt.Errorf("%w: %d species", ErrBadCount, galaxy.NumSpecies)}
+	}
+	stars, err := readStars(fsys, "stars.dat", layout)
 	if err != nil {
 		return nil, err
 	}
-	planets, err := readPlanets(filepath.Join(dataPath, "planets.dat"), bo)
+	planets, err := readPlanets(fsys, "planets.dat", layout)
 	if err != nil {
 		return nil, err
 	}
+	for i, star := range stars {
+		if star.NumPlanets < 0 || star.PlanetIndex < 0 || int(star.PlanetIndex)+int(star.NumPlanets) > len(planets) {
+			offset := int64(4 + i*layout.StarSize)
+			return nil, &DataError{File: "stars.dat", Record: "star_data", Index: i, Offset: offset, Err: fmt.Errorf("planets %d through %d are not in planets.dat", star.PlanetIndex, int(star.PlanetIndex)+int(star.NumPlanets)-1)}
+		}
+	}
+	// every planet must belong to exactly one star
+	owner := make([]int, len(planets), len(planets))
+	for i, star := range stars {
+		for pn := int(star.PlanetIndex); pn < int(star.PlanetIndex)+int(star.NumPlanets); pn++ {
+			if owner[pn] != 0 {
+				offset := int64(4 + i*layout.StarSize)
+				return nil, &DataError{File: "stars.dat", Record: "star_data", Index: i, Offset: offset, Err: fmt.Errorf("planet %d is also claimed by star %d", pn, owner[pn]-1)}
+			}
+			owner[pn] = i + 1
+		}
+	}
+	for pn := range planets {
+		if owner[pn] == 0 {
+			offset := int64(4 + pn*layout.PlanetSize)
+			return nil, &DataError{File: "planets.dat", Record: "planet_data", Index: pn, Offset: offset, Err: fmt.Errorf("planet %d is not claimed by any star", pn)}
+		}
+	}
 	var speciesData []*species_file
 	for i := 0; i < int(galaxy.NumSpecies); i++ {
 		spNo := i + 1
-		sp, err := readSpecies(filepath.Join(dataPath, fmt.Sprintf("sp%02d.dat", spNo)), bo)
+		sp, err := readSpecies(fsys, fmt.Sprintf("sp%02d.dat", spNo), layout)
 		if err != nil {
 			return nil, err
 		}
@@ -75,6 +143,7 @@ func LoadFromPath(dataPath string, bo binary.ByteOrder) (*Cluster, error) {
 			Size:      int(star.Size),
 			Type:      codeToStarType(int(star.Type)),
 			VisitedBy: make(map[string]*Species),
+			reserved:  starReserved{star.Reserved1, star.Reserved2, star.Reserved3, star.Reserved4, star.Reserved5, star.Padding},
 		}
 		system.Is.HomeSystem = star.HomeSystem != 0
 
@@ -119,9 +188,10 @@ func LoadFromPath(dataPath string, bo binary.ByteOrder) (*Cluster, error) {
 		planet.MiningDifficultyIncrease = int(pp.MDIncrease)
 		planet.PressureClass = int(pp.PressureClass)
 		planet.TemperatureClass = int(pp.TemperatureClass)
+		planet.reserved = planetReserved{pp.Reserved1, pp.Reserved2, pp.Reserved3, pp.Reserved4, pp.Reserved5}
 		for i, code := range pp.Gas {
-			if pp.GasPercent[i] != 0 {
-				planet.Atmosphere = append(planet.Atmosphere, &AtmosphericGas{Gas: codeToGas(int(code)), Pct: int(pp.GasPercent[i])})
+			if code != 0 || pp.GasPercent[i] != 0 {
+				planet.Atmosphere = append(planet.Atmosphere, &AtmosphericGas{Gas: codeToGas(int(code)), Pct: int(pp.GasPercent[i]), Slot: i})
 			}
 		}
 		switch int(pp.Special) {
@@ -151,6 +221,7 @@ func LoadFromPath(dataPath string, bo binary.ByteOrder) (*Cluster, error) {
 			GovtType:               nameToString(species.GovtType),
 			HomePlanetOriginalBase: int(species.HPOriginalBase),
 			Name:                   nameToString(species.Name),
+			reserved:               speciesReserved{species.Reserved3, species.Reserved4, species.Reserved5, species.Padding},
 		}
 		coords, orbit := Coords{X: int(species.X), Y: int(species.Y), Z: int(species.Z)}, int(species.PN)
 		for _, planet := range cluster.Planets {
@@ -160,6 +231,9 @@ func LoadFromPath(dataPath string, bo binary.ByteOrder) (*Cluster, error) {
 				break
 			}
 		}
+		if cluster.Species[i].HomePlanet == nil {
+			return nil, &DataError{File: fmt.Sprintf("sp%02d.dat", spNo), Record: "species_data", Index: 0, Offset: 96, Err: fmt.Errorf("home planet %s #%d is not in planets.dat", coords, orbit)}
+		}
 		for _, code := range species.NeutralGas {
 			if code != 0 {
 				cluster.Species[i].Gases.Neutral = append(cluster.Species[i].Gases.Neutral, codeToGas(int(code)))
@@ -235,8 +309,11 @@ func LoadFromPath(dataPath string, bo binary.ByteOrder) (*Cluster, error) {
 				PopulationUnits:   int(nampla.PopUnits),
 				Shipyards:         int(nampla.Shipyards),
 				SiegeEffPct:       int(nampla.SiegeEff),
+				Special:           int(nampla.Special),
 				Species:           cluster.Species[i],
+				Status:            int(nampla.Status),
 				UseOnAmbush:       int(nampla.UseOnAmbush),
+				reserved:          namplaReserved{nampla.Reserved1, nampla.Reserved2, nampla.Reserved4, nampla.Reserved5, nampla.Reserved6, nampla.Padding},
 			}
 			cluster.Species[i].Colonies = append(cluster.Species[i].Colonies, colony)
 
@@ -307,10 +384,14 @@ func LoadFromPath(dataPath string, bo binary.ByteOrder) (*Cluster, error) {
 				Orbit:              int(sh.PN),
 				RemainingCost:      int(sh.RemainingCost),
 				Size:               codeToShipSize(int(sh.Class), int(sh.Tonnage)),
+				Special:            int(sh.Special),
 				Species:            cluster.Species[i],
+				Status:             ShipStatus(sh.Status),
 				SubLight:           sh.Type != 0 || sh.Class == 16, /* sublight or starbase */
 				Tonnage:            codeToShipTonnage(int(sh.Class), int(sh.Tonnage)),
+				Type:               int(sh.Type),
 				UnderConstruction:  sh.Status == UNDER_CONSTRUCTION,
+				reserved:           shipReserved{sh.Reserved1, sh.Reserved2, sh.Reserved3, sh.Reserved4, sh.Padding, sh.MorePadding},
 			}
 			cluster.Species[i].Ships = append(cluster.Species[i].Ships, ship)
 
@@ -322,15 +403,87 @@ func LoadFromPath(dataPath string, bo binary.ByteOrder) (*Cluster, error) {
 					ship.Inventory = append(ship.Inventory, item)
 				}
 			}
+			ship.Location.Coords = ship.Coords
 			for _, system := range cluster.Systems {
 				if ship.Coords.Equals(system.Coords) {
 					ship.Location.System = system
-					if ship.Orbit != 0 {
+					if 0 < ship.Orbit && ship.Orbit <= len(system.Planets) {
 						ship.Location.Planet = system.Planets[ship.Orbit-1]
 					}
 					break
 				}
 			}
+
+			// the original cost is discounted for sub-light ships and maintenance is a percentage of
+			// the cost, which is then discounted by half of the species' military tech level.
+			// ships under construction and unused ship records don't need maintenance.
+			// the engine takes the discount from the fleet total, so the rounding here means
+			// the ships' costs may not add up to the species' fleet maintenance cost.
+			ship.TotalCost = codeToShipCost(int(sh.Class), int(sh.Tonnage))
+			if sh.Type == SUB_LIGHT {
+				ship.TotalCost -= (25 * ship.TotalCost) / 100
+			}
+			if !ship.UnderConstruction && ship.Orbit != UNUSED_SHIP_ORBIT {
+				ship.MaintenanceCost = (codeToShipMaintenancePct(int(sh.Class)) * ship.TotalCost) / 100
+				ship.MaintenanceCost -= (cluster.Species[i].ML.CurrentLevel / 2 * ship.MaintenanceCost) / 100
+			}
+
+			// a ship on the surface of a planet is hidden if the species' colony there is hiding
+			if ship.OnSurface && ship.Location.Planet != nil {
+				for _, colony := range cluster.Species[i].Colonies {
+					if colony.Planet == ship.Location.Planet {
+						ship.Hiding = colony.Is.Hiding
+						break
+					}
+				}
+			}
+
+			// link the ship to the colonies where it loads and unloads
+			var ok bool
+			if ship.LoadingPoint, ok = namplaIndexToColony(cluster.Species[i], int(sh.LoadingPoint)); !ok {
+				offset := int64(layout.SpeciesSize + len(sp.namplas)*layout.NamplaSize + n*layout.ShipSize)
+				return nil, &DataError{File: fmt.Sprintf("sp%02d.dat", i+1), Record: "ship_data", Index: n, Offset: offset, Err: fmt.Errorf("loading point %d is not a colony", sh.LoadingPoint)}
+			}
+			if ship.UnloadingPoint, ok = namplaIndexToColony(cluster.Species[i], int(sh.UnloadingPoint)); !ok {
+				offset := int64(layout.SpeciesSize + len(sp.namplas)*layout.NamplaSize + n*layout.ShipSize)
+				return nil, &DataError{File: fmt.Sprintf("sp%02d.dat", i+1), Record: "ship_data", Index: n, Offset: offset, Err: fmt.Errorf("unloading point %d is not a colony", sh.UnloadingPoint)}
+			}
+
+			// link the ship to its destination. the destination may be in deep space.
+			// if the ship unloads in the destination system, the destination is the unloading point.
+			// the data file has no flag for "no destination", so 0,0,0 is taken to mean none,
+			// even though it is a valid coordinate. a ship headed for a system at 0,0,0 will
+			// have no destination.
+			if sh.DestX != 0 || sh.DestY != 0 || sh.DestZ != 0 {
+				ship.Destination = &Location{Coords: Coords{X: int(sh.DestX), Y: int(sh.DestY), Z: int(sh.DestZ)}}
+				for _, system := range cluster.Systems {
+					if ship.Destination.Coords.Equals(system.Coords) {
+						ship.Destination.System = system
+						break
+					}
+				}
+				if ship.UnloadingPoint != nil && ship.Destination.System != nil && ship.UnloadingPoint.System == ship.Destination.System {
+					ship.Destination.Colony = ship.UnloadingPoint
+					ship.Destination.Planet = ship.UnloadingPoint.Planet
+				}
+			}
+		}
+	}
+
+	// link species to the species they have contacted, allied with, or declared as enemies.
+	for i, sp := range speciesData {
+		species := cluster.Species[i]
+		for n, other := range cluster.Species {
+			spNo := n + 1
+			if sp.data.Contact.IsSet(spNo) {
+				species.Contacts[other.Name] = other
+			}
+			if sp.data.Ally.IsSet(spNo) {
+				species.Allies[other.Name] = other
+			}
+			if sp.data.Enemy.IsSet(spNo) {
+				species.Enemies[other.Name] = other
+			}
 		}
 	}
 
@@ -340,7 +493,7 @@ func LoadFromPath(dataPath string, bo binary.ByteOrder) (*Cluster, error) {
 		system := cluster.Systems[i]
 		for n, species := range cluster.Species {
 			spNo := n + 1
-			if hasVisited := speciesBitIsSet(star.VisitedBy, spNo); hasVisited {
+			if hasVisited := star.VisitedBy.IsSet(spNo); hasVisited {
 				system.VisitedBy[species.Name] = species
 				species.SystemsVisited = append(species.SystemsVisited, system)
 			}
@@ -413,8 +566,273 @@ func LoadFromPath(dataPath string, bo binary.ByteOrder) (*Cluster, error) {
 	// copy the life support into the colonies
 	for i, species := range cluster.Species {
 		for _, colony := range species.Colonies {
-			colony.LSN = colony.Planet.LSN[i]
+			if colony.Planet != nil {
+				colony.LSN = colony.Planet.LSN[i]
+			}
+		}
+	}
+
+	// calculate the production of each colony and species
+	for _, species := range cluster.Species {
+		for _, colony := range species.Colonies {
+			colony.Production = colonyProduction(species, colony)
+			species.EconUnitsProduced += colony.Production
 		}
 	}
 	return cluster, nil
 }
+
+// withDataPath adds the data path to errors from loading files from a directory.
+func withDataPath(dataPath string, err error) error {
+	var de *DataError
+	if errors.As(err, &de) {
+		de.File = filepath.Join(dataPath, de.File)
+		return err
+	}
+	return fmt.Errorf("%s: %w", dataPath, err)
+}
+
+// SaveToPath writes the galaxy, stars, planets, and species files to the given path.
+// It is the counterpart to LoadFromPath; saving an unmodified cluster produces the files it was loaded from.
+// The status of colonies and ships is saved from their Status fields, and the type of ships from their Type
+// fields, not from the flags derived from them.
+func SaveToPath(dataPath string, bo binary.ByteOrder, cluster *Cluster) error {
+	return SaveToPathWithLayout(dataPath, NewLayout(bo), cluster)
+}
+
+// SaveToPathWithLayout writes the galaxy, stars, planets, and species files to the given path using the layout.
+func SaveToPathWithLayout(dataPath string, layout *Layout, cluster *Cluster) error {
+	// translate the galaxy data
+	galaxy := &galaxy_data{
+		DNumSpecies: int32(cluster.DesignedNumSpecies),
+		NumSpecies:  int32(len(cluster.Species)),
+		Radius:      int32(cluster.Radius),
+		TurnNumber:  int32(cluster.Turn),
+	}
+
+	// translate the star data
+	stars := make([]star_data, len(cluster.Systems), len(cluster.Systems))
+	for i, system := range cluster.Systems {
+		star := &stars[i]
+		star.X, star.Y, star.Z = int8(system.Coords.X), int8(system.Coords.Y), int8(system.Coords.Z)
+		star.Type = int8(starTypeToCode(system.Type))
+		star.Color = int8(starColorToCode(system.Color))
+		star.Size = int8(system.Size)
+		star.NumPlanets = int8(len(system.Planets))
+		if system.Is.HomeSystem {
+			star.HomeSystem = 1
+		}
+		if system.WormholeExit != nil {
+			star.WormHere = 1
+			star.WormX, star.WormY, star.WormZ = int8(system.WormholeExit.Coords.X), int8(system.WormholeExit.Coords.Y), int8(system.WormholeExit.Coords.Z)
+		}
+		if len(system.Planets) != 0 {
+			star.PlanetIndex = int16(system.Planets[0].Id - 1)
+		}
+		star.Message = int32(system.Message)
+		r := system.reserved
+		star.Reserved1, star.Reserved2, star.Reserved3, star.Reserved4, star.Reserved5, star.Padding = r.Reserved1, r.Reserved2, r.Reserved3, r.Reserved4, r.Reserved5, r.Padding
+		for n, species := range cluster.Species {
+			spNo := n + 1
+			if _, ok := system.VisitedBy[species.Name]; ok {
+				star.VisitedBy.Set(spNo)
+			}
+		}
+	}
+
+	// translate the planet data
+	planets := make([]planet_data, len(cluster.Planets), len(cluster.Planets))
+	for pn, planet := range cluster.Planets {
+		pp := &planets[pn]
+		pp.TemperatureClass = int8(planet.TemperatureClass)
+		pp.PressureClass = int8(planet.PressureClass)
+		switch {
+		case planet.Is.IdealHomePlanet:
+			pp.Special = 1
+		case planet.Is.IdealColonyPlanet:
+			pp.Special = 2
+		case planet.Is.RadioactiveHellHole:
+			pp.Special = 3
+		}
+		// gases go back in the slots they were loaded from. gases without a
+		// slot of their own, such as ones added since, take the first free slots.
+		var used [len(pp.Gas)]bool
+		var unslotted []*AtmosphericGas
+		for _, atmo := range planet.Atmosphere {
+			if 0 <= atmo.Slot && atmo.Slot < len(pp.Gas) && !used[atmo.Slot] {
+				used[atmo.Slot] = true
+				pp.Gas[atmo.Slot], pp.GasPercent[atmo.Slot] = int8(gasToCode(atmo.Gas)), int8(atmo.Pct)
+			} else {
+				unslotted = append(unslotted, atmo)
+			}
+		}
+		for slot := 0; slot < len(pp.Gas) && len(unslotted) != 0; slot++ {
+			if !used[slot] {
+				used[slot] = true
+				pp.Gas[slot], pp.GasPercent[slot] = int8(gasToCode(unslotted[0].Gas)), int8(unslotted[0].Pct)
+				unslotted = unslotted[1:]
+			}
+		}
+		pp.Diameter = int16(planet.Diameter)
+		pp.Gravity = int16(planet.Gravity)
+		pp.MiningDifficulty = int16(planet.MiningDifficultyBase)
+		pp.EconEfficiency = int16(planet.EconEfficiency)
+		pp.MDIncrease = int16(planet.MiningDifficultyIncrease)
+		pp.Message = int32(planet.Message)
+		r := planet.reserved
+		pp.Reserved1, pp.Reserved2, pp.Reserved3, pp.Reserved4, pp.Reserved5 = r.Reserved1, r.Reserved2, r.Reserved3, r.Reserved4, r.Reserved5
+	}
+
+	// translate the species data
+	var speciesData []*species_file
+	for _, species := range cluster.Species {
+		sp := &species_file{data: &species_data{}}
+		speciesData = append(speciesData, sp)
+
+		data := sp.data
+		data.Name = stringToName(species.Name)
+		data.GovtName = stringToName(species.GovtName)
+		data.GovtType = stringToName(species.GovtType)
+		if species.HomePlanet != nil {
+			data.X, data.Y, data.Z = uint8(species.HomePlanet.Coords.X), uint8(species.HomePlanet.Coords.Y), uint8(species.HomePlanet.Coords.Z)
+			data.PN = uint8(species.HomePlanet.Orbit)
+		}
+		data.RequiredGas = uint8(gasToCode(species.Gases.Required.Gas))
+		data.RequiredGasMin = uint8(species.Gases.Required.MinPct)
+		data.RequiredGasMax = uint8(species.Gases.Required.MaxPct)
+		for i, gas := range species.Gases.Neutral {
+			if i < len(data.NeutralGas) {
+				data.NeutralGas[i] = uint8(gasToCode(gas))
+			}
+		}
+		for i, gas := range species.Gases.Poison {
+			if i < len(data.PoisonGas) {
+				data.PoisonGas[i] = uint8(gasToCode(gas))
+			}
+		}
+		if species.AutoOrders {
+			data.AutoOrders = 1
+		}
+		for i, tech := range []Tech{species.MI, species.MA, species.ML, species.GV, species.LS, species.BI} {
+			data.TechLevel[i] = int16(tech.CurrentLevel)
+			data.InitTechLevel[i] = int16(tech.InitialLevel)
+			data.TechKnowledge[i] = int16(tech.KnowledgeLevel)
+			data.TechEps[i] = int32(tech.XPs)
+		}
+		data.HPOriginalBase = int32(species.HomePlanetOriginalBase)
+		data.EconUnits = int32(species.EconUnitsBanked)
+		data.FleetCost = int32(species.FleetMaintenanceCost)
+		data.FleetPercentCost = int32(species.FleetMaintenancePct)
+		r := species.reserved
+		data.Reserved3, data.Reserved4, data.Reserved5, data.Padding = r.Reserved3, r.Reserved4, r.Reserved5, r.Padding
+		for n, other := range cluster.Species {
+			spNo := n + 1
+			if _, ok := species.Contacts[other.Name]; ok {
+				data.Contact.Set(spNo)
+			}
+			if _, ok := species.Allies[other.Name]; ok {
+				data.Ally.Set(spNo)
+			}
+			if _, ok := species.Enemies[other.Name]; ok {
+				data.Enemy.Set(spNo)
+			}
+		}
+
+		// translate the species colony data
+		sp.namplas = make([]nampla_data, len(species.Colonies), len(species.Colonies))
+		for n, colony := range species.Colonies {
+			nampla := &sp.namplas[n]
+			nampla.Name = stringToName(colony.Name)
+			nampla.X, nampla.Y, nampla.Z = uint8(colony.Coords.X), uint8(colony.Coords.Y), uint8(colony.Coords.Z)
+			nampla.PN = uint8(colony.Orbit)
+			nampla.Status = uint8(colony.Status)
+			if colony.Is.Hiding {
+				nampla.Hiding = 1
+			}
+			if colony.Is.Hidden {
+				nampla.Hidden = 1
+			}
+			if colony.Planet != nil {
+				nampla.PlanetIndex = int16(colony.Planet.Id - 1)
+			}
+			nampla.SiegeEff = int16(colony.SiegeEffPct)
+			nampla.Shipyards = int16(colony.Shipyards)
+			if colony.DevelopIUs != nil {
+				nampla.IUsNeeded = int32(colony.DevelopIUs.UnitsNeeded)
+				nampla.AutoIUs = int32(colony.DevelopIUs.AutoInstall)
+				nampla.IUsToInstall = int32(colony.DevelopIUs.UnitsToInstall)
+			}
+			if colony.DevelopAUs != nil {
+				nampla.AUsNeeded = int32(colony.DevelopAUs.UnitsNeeded)
+				nampla.AutoAUs = int32(colony.DevelopAUs.AutoInstall)
+				nampla.AUsToInstall = int32(colony.DevelopAUs.UnitsToInstall)
+			}
+			nampla.MiBase = int32(colony.MiningBase)
+			nampla.MaBase = int32(colony.ManufacturingBase)
+			nampla.PopUnits = int32(colony.PopulationUnits)
+			for _, item := range colony.Inventory {
+				if code := itemToCode(item.Code); code >= 0 {
+					nampla.ItemQuantity[code] = int32(item.Quantity)
+				}
+			}
+			nampla.UseOnAmbush = int32(colony.UseOnAmbush)
+			nampla.Message = int32(colony.Message)
+			nampla.Special = int32(colony.Special)
+			r := colony.reserved
+			nampla.Reserved1, nampla.Reserved2, nampla.Reserved4, nampla.Reserved5, nampla.Reserved6, nampla.Padding = r.Reserved1, r.Reserved2, r.Reserved4, r.Reserved5, r.Reserved6, r.Padding
+		}
+
+		// translate the species ship data
+		sp.ships = make([]ship_data, len(species.Ships), len(species.Ships))
+		for n, ship := range species.Ships {
+			sh := &sp.ships[n]
+			sh.Name = stringToName(ship.Name)
+			sh.X, sh.Y, sh.Z = uint8(ship.Coords.X), uint8(ship.Coords.Y), uint8(ship.Coords.Z)
+			sh.PN = uint8(ship.Orbit)
+			sh.Status = uint8(ship.Status)
+			sh.Type = uint8(ship.Type)
+			class := shipClassToCode(ship.Class)
+			if ship.JustJumped {
+				sh.JustJumped = 1
+			}
+			if ship.ArrivedViaWormhole {
+				sh.ArrivedViaWormhole = 1
+			}
+			sh.Class = int16(class)
+			sh.Tonnage = int16(ship.Tonnage / 10_000)
+			for _, item := range ship.Inventory {
+				if code := itemToCode(item.Code); code >= 0 {
+					sh.ItemQuantity[code] = int16(item.Quantity)
+				}
+			}
+			sh.Age = int16(ship.Age)
+			sh.RemainingCost = int16(ship.RemainingCost)
+			if ship.Destination != nil {
+				sh.DestX, sh.DestY, sh.DestZ = uint8(ship.Destination.Coords.X), uint8(ship.Destination.Coords.Y), uint8(ship.Destination.Coords.Z)
+			}
+			sh.LoadingPoint = int16(colonyToNamplaIndex(species, ship.LoadingPoint))
+			sh.UnloadingPoint = int16(colonyToNamplaIndex(species, ship.UnloadingPoint))
+			sh.Special = int32(ship.Special)
+			r := ship.reserved
+			sh.Reserved1, sh.Reserved2, sh.Reserved3, sh.Reserved4, sh.Padding, sh.MorePadding = r.Reserved1, r.Reserved2, r.Reserved3, r.Reserved4, r.Padding, r.MorePadding
+		}
+	}
+
+	// write the galaxy, stars, planets, and species data to the binary files.
+	if err := writeGalaxy(filepath.Join(dataPath, "galaxy.dat"), layout.ByteOrder, galaxy); err != nil {
+		return err
+	}
+	if err := writeStars(filepath.Join(dataPath, "stars.dat"), layout, stars); err != nil {
+		return err
+	}
+	if err := writePlanets(filepath.Join(dataPath, "planets.dat"), layout, planets); err != nil {
+		return err
+	}
+	for i, sp := range speciesData {
+		spNo := i + 1
+		if err := writeSpecies(filepath.Join(dataPath, fmt.Sprintf("sp%02d.dat", spNo)), layout, sp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
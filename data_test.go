@@ -0,0 +1,518 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoadFromFSPlanetCoverage(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		stars      []star_data
+		numPlanets int
+		file       string // the file named in the error, if any
+		index      int
+		err        string
+	}{
+		{
+			name:       "covered",
+			stars:      []star_data{{NumPlanets: 2}, {X: 1, NumPlanets: 1, PlanetIndex: 2}},
+			numPlanets: 3,
+		},
+		{
+			name:       "unclaimed",
+			stars:      []star_data{{NumPlanets: 1}},
+			numPlanets: 2,
+			file:       "planets.dat", index: 1, err: "planet 1 is not claimed by any star",
+		},
+		{
+			name:       "gap",
+			stars:      []star_data{{NumPlanets: 1}, {X: 1, NumPlanets: 1, PlanetIndex: 2}},
+			numPlanets: 3,
+			file:       "planets.dat", index: 1, err: "planet 1 is not claimed by any star",
+		},
+		{
+			name:       "overlap",
+			stars:      []star_data{{NumPlanets: 2}, {X: 1, NumPlanets: 2, PlanetIndex: 1}},
+			numPlanets: 3,
+			file:       "stars.dat", index: 1, err: "planet 1 is also claimed by star 0",
+		},
+		{
+			name:       "out of range",
+			stars:      []star_data{{NumPlanets: 3}},
+			numPlanets: 2,
+			file:       "stars.dat", index: 0, err: "planets 0 through 2 are not in planets.dat",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			layout := NewLayout(binary.LittleEndian)
+			if err := writeGalaxy(filepath.Join(dir, "galaxy.dat"), layout.ByteOrder, &galaxy_data{Radius: 10, TurnNumber: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeStars(filepath.Join(dir, "stars.dat"), layout, tc.stars); err != nil {
+				t.Fatal(err)
+			}
+			if err := writePlanets(filepath.Join(dir, "planets.dat"), layout, make([]planet_data, tc.numPlanets)); err != nil {
+				t.Fatal(err)
+			}
+
+			cluster, err := LoadFromFS(os.DirFS(dir), layout)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("want nil: got %v", err)
+				} else if len(cluster.Planets) != tc.numPlanets {
+					t.Fatalf("planets: want %d: got %d", tc.numPlanets, len(cluster.Planets))
+				}
+				return
+			}
+			var de *DataError
+			if !errors.As(err, &de) {
+				t.Fatalf("want *DataError: got %v", err)
+			}
+			if de.File != tc.file || de.Index != tc.index || !strings.Contains(de.Err.Error(), tc.err) {
+				t.Errorf("want %s %d %q: got %v", tc.file, tc.index, tc.err, err)
+			}
+		})
+	}
+}
+
+// writeTestFiles writes a turn of a small cluster to dir: three systems,
+// two of them joined by a wormhole, four planets and two species with
+// colonies and ships. Every field that the loader translates has a value that
+// is not zero somewhere, so that a round trip exercises it.
+func writeTestFiles(t *testing.T, dir string, layout *Layout, turn int) {
+	t.Helper()
+	var visited speciesBitset
+	visited.Set(1)
+	visited.Set(2)
+	stars := []star_data{
+		{X: 1, Y: 2, Z: 3, Type: 3, Color: 5, Size: 4, NumPlanets: 2, HomeSystem: 1, WormHere: 1, WormX: 10, WormY: 11, WormZ: 12, Message: 7, VisitedBy: visited},
+		{X: 4, Y: 5, Z: 6, Type: 1, Color: 7, Size: 2, NumPlanets: 1, PlanetIndex: 2},
+		{X: 10, Y: 11, Z: 12, Type: 4, Color: 2, Size: 9, NumPlanets: 1, PlanetIndex: 3, WormHere: 1, WormX: 1, WormY: 2, WormZ: 3},
+	}
+	stars[1].VisitedBy.Set(2)
+	planets := []planet_data{
+		{TemperatureClass: 12, PressureClass: 9, Special: 1, Gas: [4]int8{5, 7, 6}, GasPercent: [4]int8{70, 25, 5}, Diameter: 13, Gravity: 100, MiningDifficulty: 150, EconEfficiency: 100, MDIncrease: 3, Message: 2},
+		// an empty slot before a used one, and a gas with no percentage
+		{TemperatureClass: 3, PressureClass: 0, Special: 3, Gas: [4]int8{0, 4}, GasPercent: [4]int8{0, 100}, Diameter: 4, Gravity: 40, MiningDifficulty: 400, EconEfficiency: 60},
+		{TemperatureClass: 14, PressureClass: 11, Special: 2, Gas: [4]int8{7, 5, 3}, GasPercent: [4]int8{30, 70}, Diameter: 11, Gravity: 90, MiningDifficulty: 220, EconEfficiency: 80, MDIncrease: 1},
+		{TemperatureClass: 20, PressureClass: 27, Gas: [4]int8{1, 3, 2, 4}, GasPercent: [4]int8{40, 30, 20, 10}, Diameter: 120, Gravity: 300, MiningDifficulty: 900, EconEfficiency: 20},
+	}
+	species := []*species_file{
+		{
+			data: &species_data{
+				Name: stringToName("Alpha"), GovtName: stringToName("Council"), GovtType: stringToName("Democracy"),
+				X: 1, Y: 2, Z: 3, PN: 1,
+				RequiredGas: 7, RequiredGasMin: 10, RequiredGasMax: 30,
+				NeutralGas: [6]uint8{5, 6, 3}, PoisonGas: [6]uint8{9, 10, 12, 13},
+				AutoOrders:     1,
+				TechLevel:      [6]int16{10, 12, 14, 3, 5, 7},
+				InitTechLevel:  [6]int16{9, 11, 13, 2, 4, 6},
+				TechKnowledge:  [6]int16{11, 13, 15, 4, 6, 8},
+				TechEps:        [6]int32{100, 200, 300, 40, 50, 60},
+				HPOriginalBase: 1234, EconUnits: 5678, FleetCost: 90, FleetPercentCost: 250,
+			},
+			namplas: []nampla_data{
+				{Name: stringToName("Home"), X: 1, Y: 2, Z: 3, PN: 1, Status: HOME_PLANET | POPULATED, PlanetIndex: 0, Shipyards: 2, MiBase: 300, MaBase: 400, PopUnits: 50, ItemQuantity: [MAX_ITEMS]int32{0: 10, 1: 20, 4: 5}, UseOnAmbush: 3, Message: 1, Special: 4},
+				{Name: stringToName("Mine"), X: 4, Y: 5, Z: 6, PN: 1, Status: COLONY | MINING_COLONY, PlanetIndex: 2, SiegeEff: 25, Hiding: 1, Hidden: 1, IUsNeeded: 6, AutoIUs: 2, IUsToInstall: 4, MiBase: 20},
+				{Name: stringToName("Resort"), X: 1, Y: 2, Z: 3, PN: 2, Status: COLONY | RESORT_COLONY | POPULATED, PlanetIndex: 1, AUsNeeded: 7, AutoAUs: 1, AUsToInstall: 3, MaBase: 15},
+			},
+			ships: []ship_data{
+				{Name: stringToName("Scout"), X: 1, Y: 2, Z: 3, PN: 1, Status: IN_ORBIT, DestX: 4, DestY: 5, DestZ: 6, JustJumped: 1, Class: 0, Tonnage: 1, Age: 3, LoadingPoint: 9999, UnloadingPoint: 1},
+				{Name: stringToName("Hauler"), X: 4, Y: 5, Z: 6, PN: 1, Status: ON_SURFACE, Type: SUB_LIGHT, Class: 17, Tonnage: 3, ItemQuantity: [MAX_ITEMS]int16{4: 30}, LoadingPoint: 2},
+				{Name: stringToName("Base"), X: 1, Y: 2, Z: 3, PN: 1, Status: UNDER_CONSTRUCTION, Type: STARBASE, Class: 16, Tonnage: 5, RemainingCost: 40, Special: 9},
+				{Name: stringToName("Lost"), X: 7, Y: 8, Z: 9, Status: IN_DEEP_SPACE, DestX: 20, DestY: 21, DestZ: 22, ArrivedViaWormhole: 1, Class: 4, Tonnage: 15},
+				// a starbase by type that is not of the starbase class
+				{Name: stringToName("Odd"), X: 1, Y: 2, Z: 3, PN: 1, Status: IN_ORBIT, Type: STARBASE, Class: 4, Tonnage: 15},
+			},
+		},
+		{
+			data: &species_data{
+				Name: stringToName("Beta"), GovtName: stringToName("Hive"), GovtType: stringToName("Monarchy"),
+				X: 10, Y: 11, Z: 12, PN: 1,
+				RequiredGas: 1, RequiredGasMin: 20, RequiredGasMax: 50,
+				NeutralGas: [6]uint8{3, 2}, PoisonGas: [6]uint8{7},
+				TechLevel:      [6]int16{1, 2, 3, 4, 5, 6},
+				InitTechLevel:  [6]int16{1, 1, 1, 1, 1, 1},
+				HPOriginalBase: 99,
+			},
+			namplas: []nampla_data{
+				{Name: stringToName("Nest"), X: 10, Y: 11, Z: 12, PN: 1, Status: HOME_PLANET | POPULATED, PlanetIndex: 3, MiBase: 100, MaBase: 100, PopUnits: 10},
+			},
+			ships: []ship_data{
+				{Name: stringToName("Drone"), X: 10, Y: 11, Z: 12, PN: 1, Status: FORCED_JUMP, DestX: 1, DestY: 2, DestZ: 3, Class: 3, Tonnage: 10, ItemQuantity: [MAX_ITEMS]int16{1: 2}},
+			},
+		},
+	}
+	species[0].data.Contact.Set(2)
+	species[0].data.Ally.Set(2)
+
+	// the reserved and padding bytes are not used, but must survive a round trip
+	stars[0].Reserved1, stars[0].Reserved5, stars[0].Padding = 0x1234, -7, [2]uint8{0xfe, 0x01}
+	planets[1].Reserved1, planets[1].Reserved2, planets[1].Reserved4 = 3, 0x0506, 99
+	species[0].data.Reserved3, species[0].data.Reserved4, species[0].data.Reserved5 = 1, -2, 3
+	species[0].data.Padding[11] = 0xaa
+	species[0].namplas[1].Reserved1, species[0].namplas[1].Reserved6 = 4, 0x01020304
+	species[0].namplas[1].Padding[0] = 0x55
+	species[0].ships[2].Reserved1, species[0].ships[2].Reserved3, species[0].ships[2].Reserved4 = 9, 0x0a0b, -1
+	species[0].ships[2].Padding[27], species[0].ships[2].MorePadding = 0x77, [2]uint8{0xcd, 0xef}
+	species[1].data.Contact.Set(1)
+	species[1].data.Enemy.Set(1)
+
+	galaxy := &galaxy_data{DNumSpecies: 4, NumSpecies: int32(len(species)), Radius: 15, TurnNumber: int32(turn)}
+	if err := writeGalaxy(filepath.Join(dir, "galaxy.dat"), layout.ByteOrder, galaxy); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStars(filepath.Join(dir, "stars.dat"), layout, stars); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePlanets(filepath.Join(dir, "planets.dat"), layout, planets); err != nil {
+		t.Fatal(err)
+	}
+	for i, sp := range species {
+		if err := writeSpecies(filepath.Join(dir, fmt.Sprintf("sp%02d.dat", i+1)), layout, sp); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSaveToPathRoundTrip(t *testing.T) {
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(bo.String(), func(t *testing.T) {
+			in, out := t.TempDir(), t.TempDir()
+			writeTestFiles(t, in, NewLayout(bo), 27)
+
+			cluster, err := LoadFromPath(in, bo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := SaveToPath(out, bo, cluster); err != nil {
+				t.Fatal(err)
+			}
+
+			names := []string{"galaxy.dat", "stars.dat", "planets.dat", "sp01.dat", "sp02.dat"}
+			for _, name := range names {
+				want, err := ioutil.ReadFile(filepath.Join(in, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := ioutil.ReadFile(filepath.Join(out, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					for i := range want {
+						if i >= len(got) || got[i] != want[i] {
+							t.Errorf("%s: differs at offset %d of %d", name, i, len(want))
+							break
+						}
+					}
+					if len(got) > len(want) {
+						t.Errorf("%s: want %d bytes: got %d", name, len(want), len(got))
+					}
+				}
+			}
+			entries, err := ioutil.ReadDir(out)
+			if err != nil {
+				t.Fatal(err)
+			} else if len(entries) != len(names) {
+				t.Errorf("want %d files: got %d", len(names), len(entries))
+			}
+		})
+	}
+}
+
+func TestLoadDiplomacy(t *testing.T) {
+	// the low 16 bits of the first word are not a species
+	const unused = 1<<speciesBitsetOffset | 1
+	for _, numSpecies := range []int{3, MAX_SPECIES} {
+		t.Run(fmt.Sprint(numSpecies), func(t *testing.T) {
+			dir := t.TempDir()
+			layout := NewLayout(binary.LittleEndian)
+			if err := writeGalaxy(filepath.Join(dir, "galaxy.dat"), layout.ByteOrder, &galaxy_data{NumSpecies: int32(numSpecies), Radius: 10, TurnNumber: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeStars(filepath.Join(dir, "stars.dat"), layout, []star_data{{NumPlanets: 1}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := writePlanets(filepath.Join(dir, "planets.dat"), layout, make([]planet_data, 1)); err != nil {
+				t.Fatal(err)
+			}
+			for spNo := 1; spNo <= numSpecies; spNo++ {
+				data := &species_data{Name: stringToName(fmt.Sprintf("SP%03d", spNo)), PN: 1}
+				switch spNo {
+				case 1:
+					// species 4 through MAX_SPECIES are unused slots when there are only 3
+					data.Contact.Set(2)
+					data.Contact.Set(numSpecies)
+					data.Contact.Set(4)
+					data.Contact.Set(MAX_SPECIES)
+					data.Ally.Set(MAX_SPECIES)
+					data.Enemy.Set(2)
+					data.Contact[0] |= unused
+					data.Ally[0] |= unused
+					data.Enemy[0] |= unused
+				case numSpecies:
+					data.Contact.Set(1)
+					data.Ally.Set(1)
+					data.Enemy.Set(numSpecies - 1)
+				}
+				if err := writeSpecies(filepath.Join(dir, fmt.Sprintf("sp%02d.dat", spNo)), layout, &species_file{data: data}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cluster, err := LoadFromFS(os.DirFS(dir), layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := func(m map[string]*Species) string {
+				var list []string
+				for name, species := range m {
+					if species.Name != name {
+						t.Errorf("%s: linked to %s", name, species.Name)
+					}
+					list = append(list, name)
+				}
+				sort.Strings(list)
+				return strings.Join(list, ",")
+			}
+			// species 1 has contacted every species it has a bit for that exists
+			last := fmt.Sprintf("SP%03d", numSpecies)
+			want := map[string][3]string{ // contacts, allies and enemies
+				"SP001": {"SP002,SP003", "", "SP002"},
+				last:    {"SP001", "SP001", fmt.Sprintf("SP%03d", numSpecies-1)},
+			}
+			if numSpecies == MAX_SPECIES {
+				want["SP001"] = [3]string{"SP002,SP004," + last, last, "SP002"}
+			}
+			for _, species := range cluster.Species {
+				w := want[species.Name]
+				if got := names(species.Contacts); got != w[0] {
+					t.Errorf("%s: contacts: want %q: got %q", species.Name, w[0], got)
+				}
+				if got := names(species.Allies); got != w[1] {
+					t.Errorf("%s: allies: want %q: got %q", species.Name, w[1], got)
+				}
+				if got := names(species.Enemies); got != w[2] {
+					t.Errorf("%s: enemies: want %q: got %q", species.Name, w[2], got)
+				}
+			}
+		})
+	}
+}
+
+func TestShipCosts(t *testing.T) {
+	dir := t.TempDir()
+	layout := NewLayout(binary.LittleEndian)
+	if err := writeGalaxy(filepath.Join(dir, "galaxy.dat"), layout.ByteOrder, &galaxy_data{NumSpecies: 2, Radius: 10, TurnNumber: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStars(filepath.Join(dir, "stars.dat"), layout, []star_data{{NumPlanets: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePlanets(filepath.Join(dir, "planets.dat"), layout, make([]planet_data, 1)); err != nil {
+		t.Fatal(err)
+	}
+	ships := []ship_data{
+		{Name: stringToName("PB"), Status: IN_ORBIT, Class: 0, Tonnage: 1},
+		{Name: stringToName("DD"), Status: IN_ORBIT, Class: 4, Tonnage: 15},
+		{Name: stringToName("TR"), Status: IN_ORBIT, Class: 17, Tonnage: 3},
+		{Name: stringToName("TRS"), Status: IN_ORBIT, Type: SUB_LIGHT, Class: 17, Tonnage: 20},
+		{Name: stringToName("BA"), Status: IN_ORBIT, Type: STARBASE, Class: 16, Tonnage: 5},
+		{Name: stringToName("BA new"), Status: UNDER_CONSTRUCTION, Type: STARBASE, Class: 16, Tonnage: 5, RemainingCost: 200},
+		{Name: stringToName("Unused"), Status: IN_DEEP_SPACE, Class: 4, Tonnage: 15, PN: UNUSED_SHIP_ORBIT},
+	}
+	// ML 14 takes 7% off maintenance; ML 1 takes nothing off
+	for i, ml := range []int16{14, 1} {
+		sp := &species_file{data: &species_data{Name: stringToName(fmt.Sprintf("SP%d", i+1)), PN: 1, TechLevel: [6]int16{2: ml}}, ships: ships}
+		if err := writeSpecies(filepath.Join(dir, fmt.Sprintf("sp%02d.dat", i+1)), layout, sp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cluster, err := LoadFromFS(os.DirFS(dir), layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range [][]struct{ total, maintenance int }{
+		{
+			{100, 19},   // 20% of 100 is 20, less 7% of 20 is 1
+			{1500, 279}, // 20% of 1,500 is 300, less 7% is 21
+			{300, 12},   // 4% of 300 is 12, less 7% is 0
+			{1500, 56},  // 2,000 less 25% for sub-light, 4% of that is 60, less 7% is 4
+			{500, 47},   // a starbase is not discounted as sub-light; 10% of 500 is 50, less 7% is 3
+			{500, 0},    // under construction
+			{1500, 0},   // an unused ship record
+		},
+		{
+			{100, 20},
+			{1500, 300},
+			{300, 12},
+			{1500, 60},
+			{500, 50},
+			{500, 0},
+			{1500, 0},
+		},
+	} {
+		species := cluster.Species[i]
+		for n, ship := range species.Ships {
+			if ship.TotalCost != want[n].total || ship.MaintenanceCost != want[n].maintenance {
+				t.Errorf("%s %s: want %d %d: got %d %d", species.Name, ship.Name, want[n].total, want[n].maintenance, ship.TotalCost, ship.MaintenanceCost)
+			}
+		}
+	}
+}
+
+func TestLoadShipLinks(t *testing.T) {
+	dir := t.TempDir()
+	layout := NewLayout(binary.LittleEndian)
+	writeTestFiles(t, dir, layout, 27)
+	cluster, err := LoadFromFS(os.DirFS(dir), layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alpha := cluster.Species[0]
+	home, mine, resort := alpha.Colonies[0], alpha.Colonies[1], alpha.Colonies[2]
+	scout, hauler, lost := alpha.Ships[0], alpha.Ships[1], alpha.Ships[3]
+
+	// 9999 is the home planet and zero is none
+	if scout.LoadingPoint != home || scout.UnloadingPoint != mine {
+		t.Errorf("Scout: want loading at Home and unloading at Mine: got %v %v", scout.LoadingPoint, scout.UnloadingPoint)
+	}
+	if hauler.LoadingPoint != resort || hauler.UnloadingPoint != nil {
+		t.Errorf("Hauler: want loading at Resort and no unloading: got %v %v", hauler.LoadingPoint, hauler.UnloadingPoint)
+	}
+
+	// a destination in a system is linked to it, and to the unloading point there
+	if d := scout.Destination; d == nil || d.System != cluster.Systems[1] || d.Colony != mine || d.Planet != mine.Planet {
+		t.Errorf("Scout: want a destination at Mine: got %+v", d)
+	}
+	// 0,0,0 is no destination
+	if hauler.Destination != nil {
+		t.Errorf("Hauler: want no destination: got %+v", hauler.Destination)
+	}
+	// a destination in deep space is only coordinates
+	if d := lost.Destination; d == nil || d.Coords != (Coords{X: 20, Y: 21, Z: 22}) || d.System != nil || d.Colony != nil {
+		t.Errorf("Lost: want a destination in deep space: got %+v", d)
+	}
+
+	// Alpha has three colonies, so index 3 is the first that is out of range
+	const loadingPoint = 134 // offset of LoadingPoint in ship_data
+	name := filepath.Join(dir, "sp01.dat")
+	shipOffset := layout.SpeciesSize + 3*layout.NamplaSize + layout.ShipSize // the Hauler
+	saved, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []int16{3, -1, 9998} {
+		b := append([]byte(nil), saved...)
+		layout.ByteOrder.PutUint16(b[shipOffset+loadingPoint:], uint16(index))
+		if err := ioutil.WriteFile(name, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadFromFS(os.DirFS(dir), layout)
+		var de *DataError
+		if !errors.As(err, &de) {
+			t.Errorf("%d: want a DataError: got %v", index, err)
+			continue
+		}
+		if de.File != "sp01.dat" || de.Record != "ship_data" || de.Index != 1 || de.Offset != int64(shipOffset) ||
+			!strings.Contains(de.Error(), fmt.Sprintf("loading point %d is not a colony", index)) {
+			t.Errorf("%d: got %v", index, de)
+		}
+	}
+}
+
+func TestSaveToPathStatus(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writeTestFiles(t, in, NewLayout(binary.LittleEndian), 27)
+	cluster, err := LoadFromPath(in, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the Status fields are saved; the flags derived from them are not
+	alpha := cluster.Species[0]
+	alpha.Ships[0].Status = IN_DEEP_SPACE
+	alpha.Ships[1].InOrbit = true
+	alpha.Colonies[1].Status = COLONY
+	alpha.Colonies[2].Is.MiningColony = true
+	if err := SaveToPath(out, binary.LittleEndian, cluster); err != nil {
+		t.Fatal(err)
+	}
+	cluster, err = LoadFromPath(out, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alpha = cluster.Species[0]
+	if ship := alpha.Ships[0]; ship.Status != IN_DEEP_SPACE || !ship.InDeepSpace || ship.InOrbit {
+		t.Errorf("%s: want in deep space: got %s", ship.Name, ship.Status)
+	}
+	if ship := alpha.Ships[1]; ship.Status != ON_SURFACE || !ship.OnSurface || ship.InOrbit {
+		t.Errorf("%s: want on surface: got %s", ship.Name, ship.Status)
+	}
+	if colony := alpha.Colonies[1]; colony.Status != COLONY || colony.Is.MiningColony {
+		t.Errorf("%s: want colony only: got %d", colony.Name, colony.Status)
+	}
+	if colony := alpha.Colonies[2]; colony.Is.MiningColony || !colony.Is.ResortColony {
+		t.Errorf("%s: want resort colony: got %d", colony.Name, colony.Status)
+	}
+}
+
+func TestSaveToPathAtmosphere(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writeTestFiles(t, in, NewLayout(binary.LittleEndian), 27)
+	cluster, err := LoadFromPath(in, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second planet uses only its second slot. a gas added without a
+	// slot of its own takes the first free one.
+	planet := cluster.Planets[1]
+	planet.Atmosphere = append(planet.Atmosphere, &AtmosphericGas{Gas: codeToGas(1), Pct: 5})
+	if err := SaveToPath(out, binary.LittleEndian, cluster); err != nil {
+		t.Fatal(err)
+	}
+	planets, err := readPlanets(os.DirFS(out), "planets.dat", NewLayout(binary.LittleEndian))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := planets[1].Gas, [4]int8{1, 4}; got != want {
+		t.Errorf("gas: want %v: got %v", want, got)
+	}
+	if got, want := planets[1].GasPercent, [4]int8{5, 100}; got != want {
+		t.Errorf("gas percent: want %v: got %v", want, got)
+	}
+}
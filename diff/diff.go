@@ -0,0 +1,298 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+// Package diff compares two turns of a cluster.
+//
+// Systems are matched by their coordinates and planets by their system
+// and orbit, since neither moves between turns. Their changes are not
+// owned by any species and are reported first, as species 0.
+// Species are matched by number; a species that is missing from the
+// later turn is reported as removed.
+// Colonies and ships are matched by species and name rather than by
+// index, because the index of an object changes as others are lost.
+package diff
+
+import (
+	"github.com/mdhender/fhdata"
+	"sort"
+)
+
+// Kind is the kind of a change.
+type Kind string
+
+const (
+	ColonyCreated           Kind = "colony-created"
+	ColonyDestroyed         Kind = "colony-destroyed"
+	ColonyPopulation        Kind = "colony-population"
+	ColonyMiningBase        Kind = "colony-mining-base"
+	ColonyManufacturingBase Kind = "colony-manufacturing-base"
+	ContactMade             Kind = "contact-made"
+	EconUnits               Kind = "econ-units"
+	PlanetMiningDifficulty  Kind = "planet-mining-difficulty"
+	PlanetPressure          Kind = "planet-pressure"
+	PlanetTemperature       Kind = "planet-temperature"
+	ShipCreated             Kind = "ship-created"
+	ShipDestroyed           Kind = "ship-destroyed"
+	ShipMoved               Kind = "ship-moved"
+	SpeciesRemoved          Kind = "species-removed"
+	SystemAdded             Kind = "system-added"
+	SystemRemoved           Kind = "system-removed"
+	SystemScanned           Kind = "system-scanned"
+	SystemVisited           Kind = "system-visited"
+	TechLevel               Kind = "tech-level"
+)
+
+// Change is a single difference between two turns.
+type Change struct {
+	Kind        Kind      `json:"kind"`
+	Species     int       `json:"species"` // zero for systems and planets
+	SpeciesName string    `json:"species_name"`
+	Subject     string    `json:"subject,omitempty"` // the colony, ship, tech code, or other species
+	From        *int      `json:"from,omitempty"`    // the value before, for counts and levels
+	To          *int      `json:"to,omitempty"`      // the value after, for counts and levels
+	FromAt      *Location `json:"from_at,omitempty"` // where it was, for ships, lost colonies and removed systems
+	ToAt        *Location `json:"to_at,omitempty"`   // where it is now, or the planet that changed
+}
+
+// Location is a place in the cluster. Orbit zero is deep space.
+type Location struct {
+	X     int `json:"x"`
+	Y     int `json:"y"`
+	Z     int `json:"z"`
+	Orbit int `json:"orbit,omitempty"`
+}
+
+// Report is the list of changes from one turn to another.
+// The changes to systems and planets come first, then the changes
+// grouped by species, in species number order.
+type Report struct {
+	FromTurn int       `json:"from_turn"`
+	ToTurn   int       `json:"to_turn"`
+	Changes  []*Change `json:"changes"`
+}
+
+// Compare returns the changes from the earlier cluster to the later one.
+func Compare(from, to *fhdata.Cluster) *Report {
+	r := &Report{FromTurn: from.Turn, ToTurn: to.Turn, Changes: []*Change{}}
+
+	cc := &comparer{report: r}
+	cc.systemsAndPlanets(from.Systems, to.Systems)
+
+	before, after := make(map[int]*fhdata.Species), make(map[int]*fhdata.Species)
+	var ids []int
+	for _, sp := range from.Species {
+		before[sp.Id] = sp
+		ids = append(ids, sp.Id)
+	}
+	for _, sp := range to.Species {
+		after[sp.Id] = sp
+		if _, ok := before[sp.Id]; !ok {
+			ids = append(ids, sp.Id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		old, sp := before[id], after[id]
+		if sp == nil {
+			// there is nothing to compare a removed species with
+			c := &comparer{report: r, species: old}
+			c.add(&Change{Kind: SpeciesRemoved})
+			continue
+		} else if old == nil {
+			// a species that is new this turn has everything to report
+			old = &fhdata.Species{Id: sp.Id, Name: sp.Name}
+		}
+		c := &comparer{report: r, species: sp}
+		c.colonies(old, sp)
+		c.ships(old, sp)
+		c.tech(old, sp)
+		c.systems(SystemVisited, old.SystemsVisited, sp.SystemsVisited)
+		c.systems(SystemScanned, old.SystemsScanned, sp.SystemsScanned)
+		c.contacts(old, sp)
+		if old.EconUnitsBanked != sp.EconUnitsBanked {
+			c.add(&Change{Kind: EconUnits, From: count(old.EconUnitsBanked), To: count(sp.EconUnitsBanked)})
+		}
+	}
+	return r
+}
+
+// comparer collects the changes for one species, or for the
+// systems and planets if the species is nil.
+type comparer struct {
+	report  *Report
+	species *fhdata.Species
+}
+
+func (c *comparer) add(change *Change) {
+	if c.species != nil {
+		change.Species, change.SpeciesName = c.species.Id, c.species.Name
+	}
+	c.report.Changes = append(c.report.Changes, change)
+}
+
+// systemsAndPlanets reports systems that were added or removed and
+// changes to the planets of the systems in both turns.
+func (c *comparer) systemsAndPlanets(from, to []*fhdata.System) {
+	before := make(map[fhdata.Coords]*fhdata.System)
+	for _, system := range from {
+		if system != nil {
+			before[system.Coords] = system
+		}
+	}
+	after := make(map[fhdata.Coords]bool)
+	for _, system := range to {
+		if system == nil {
+			continue
+		}
+		after[system.Coords] = true
+		old, ok := before[system.Coords]
+		if !ok {
+			c.add(&Change{Kind: SystemAdded, ToAt: at(system.Coords, 0)})
+			continue
+		}
+		c.planets(old.Planets, system.Planets)
+	}
+	for _, system := range from {
+		if system != nil && !after[system.Coords] {
+			c.add(&Change{Kind: SystemRemoved, FromAt: at(system.Coords, 0)})
+		}
+	}
+}
+
+// planets reports the changes to the planets of a system, matched by orbit.
+func (c *comparer) planets(from, to []*fhdata.Planet) {
+	before := make(map[int]*fhdata.Planet)
+	for _, planet := range from {
+		before[planet.Orbit] = planet
+	}
+	for _, planet := range to {
+		old, ok := before[planet.Orbit]
+		if !ok {
+			continue
+		}
+		if old.MiningDifficultyBase != planet.MiningDifficultyBase {
+			c.add(&Change{Kind: PlanetMiningDifficulty, ToAt: at(planet.Coords, planet.Orbit), From: count(old.MiningDifficultyBase), To: count(planet.MiningDifficultyBase)})
+		}
+		if old.TemperatureClass != planet.TemperatureClass {
+			c.add(&Change{Kind: PlanetTemperature, ToAt: at(planet.Coords, planet.Orbit), From: count(old.TemperatureClass), To: count(planet.TemperatureClass)})
+		}
+		if old.PressureClass != planet.PressureClass {
+			c.add(&Change{Kind: PlanetPressure, ToAt: at(planet.Coords, planet.Orbit), From: count(old.PressureClass), To: count(planet.PressureClass)})
+		}
+	}
+}
+
+func (c *comparer) colonies(from, to *fhdata.Species) {
+	before := make(map[string]*fhdata.Colony)
+	for _, colony := range from.Colonies {
+		before[colony.Name] = colony
+	}
+	after := make(map[string]bool)
+	for _, colony := range to.Colonies {
+		after[colony.Name] = true
+		old, ok := before[colony.Name]
+		if !ok {
+			c.add(&Change{Kind: ColonyCreated, Subject: colony.Name, ToAt: at(colony.Coords, colony.Orbit), To: count(colony.PopulationUnits)})
+			continue
+		}
+		if old.PopulationUnits != colony.PopulationUnits {
+			c.add(&Change{Kind: ColonyPopulation, Subject: colony.Name, From: count(old.PopulationUnits), To: count(colony.PopulationUnits)})
+		}
+		if old.MiningBase != colony.MiningBase {
+			c.add(&Change{Kind: ColonyMiningBase, Subject: colony.Name, From: count(old.MiningBase), To: count(colony.MiningBase)})
+		}
+		if old.ManufacturingBase != colony.ManufacturingBase {
+			c.add(&Change{Kind: ColonyManufacturingBase, Subject: colony.Name, From: count(old.ManufacturingBase), To: count(colony.ManufacturingBase)})
+		}
+	}
+	for _, colony := range from.Colonies {
+		if !after[colony.Name] {
+			c.add(&Change{Kind: ColonyDestroyed, Subject: colony.Name, FromAt: at(colony.Coords, colony.Orbit), From: count(colony.PopulationUnits)})
+		}
+	}
+}
+
+func (c *comparer) ships(from, to *fhdata.Species) {
+	before := make(map[string]*fhdata.Ship)
+	for _, ship := range from.Ships {
+		before[ship.Name] = ship
+	}
+	after := make(map[string]bool)
+	for _, ship := range to.Ships {
+		after[ship.Name] = true
+		old, ok := before[ship.Name]
+		if !ok {
+			c.add(&Change{Kind: ShipCreated, Subject: ship.Name, ToAt: at(ship.Coords, ship.Orbit)})
+		} else if !old.Coords.Equals(ship.Coords) || old.Orbit != ship.Orbit {
+			c.add(&Change{Kind: ShipMoved, Subject: ship.Name, FromAt: at(old.Coords, old.Orbit), ToAt: at(ship.Coords, ship.Orbit)})
+		}
+	}
+	for _, ship := range from.Ships {
+		if !after[ship.Name] {
+			c.add(&Change{Kind: ShipDestroyed, Subject: ship.Name, FromAt: at(ship.Coords, ship.Orbit)})
+		}
+	}
+}
+
+func (c *comparer) tech(from, to *fhdata.Species) {
+	before := []fhdata.Tech{from.MI, from.MA, from.ML, from.GV, from.LS, from.BI}
+	for i, tech := range []fhdata.Tech{to.MI, to.MA, to.ML, to.GV, to.LS, to.BI} {
+		if before[i].CurrentLevel != tech.CurrentLevel {
+			c.add(&Change{Kind: TechLevel, Subject: tech.Code, From: count(before[i].CurrentLevel), To: count(tech.CurrentLevel)})
+		}
+	}
+}
+
+// systems reports the systems in the later list that are not in the earlier one.
+func (c *comparer) systems(kind Kind, from, to []*fhdata.System) {
+	before := make(map[fhdata.Coords]bool)
+	for _, system := range from {
+		before[system.Coords] = true
+	}
+	for _, system := range to {
+		if !before[system.Coords] {
+			c.add(&Change{Kind: kind, ToAt: at(system.Coords, 0)})
+		}
+	}
+}
+
+func (c *comparer) contacts(from, to *fhdata.Species) {
+	var names []string
+	for name := range to.Contacts {
+		if _, ok := from.Contacts[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.add(&Change{Kind: ContactMade, Subject: name})
+	}
+}
+
+func count(n int) *int {
+	return &n
+}
+
+func at(c fhdata.Coords, orbit int) *Location {
+	return &Location{X: c.X, Y: c.Y, Z: c.Z, Orbit: orbit}
+}
@@ -0,0 +1,176 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package diff
+
+import (
+	"github.com/mdhender/fhdata"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompareMatchesByName(t *testing.T) {
+	colony := func(name string, x, pop int) *fhdata.Colony {
+		return &fhdata.Colony{Name: name, Coords: fhdata.Coords{X: x, Y: 1, Z: 1}, Orbit: 1, PopulationUnits: pop}
+	}
+	ship := func(name string, x int) *fhdata.Ship {
+		return &fhdata.Ship{Name: name, Coords: fhdata.Coords{X: x, Y: 1, Z: 1}}
+	}
+	from := &fhdata.Cluster{Turn: 4, Species: []*fhdata.Species{
+		{
+			Id: 1, Name: "Alpha",
+			Colonies: []*fhdata.Colony{colony("Home", 1, 50), colony("Lost", 2, 5), colony("Kept", 3, 7)},
+			Ships:    []*fhdata.Ship{ship("Sunk", 1), ship("Mover", 1), ship("Idle", 2)},
+		},
+		{Id: 2, Name: "Beta", Colonies: []*fhdata.Colony{colony("Nest", 9, 10)}},
+	}}
+	// every colony and ship after the lost ones has a new index
+	to := &fhdata.Cluster{Turn: 5, Species: []*fhdata.Species{
+		{Id: 3, Name: "Gamma", Colonies: []*fhdata.Colony{colony("Hive", 8, 12)}},
+		{
+			Id: 1, Name: "Alpha",
+			Colonies: []*fhdata.Colony{colony("Home", 1, 50), colony("Kept", 3, 9), colony("New", 4, 1)},
+			Ships:    []*fhdata.Ship{ship("Mover", 3), ship("Idle", 2), ship("Built", 1)},
+		},
+	}}
+
+	type change struct {
+		Kind    Kind
+		Species int
+		Subject string
+	}
+	want := []change{
+		{ColonyPopulation, 1, "Kept"},
+		{ColonyCreated, 1, "New"},
+		{ColonyDestroyed, 1, "Lost"},
+		{ShipMoved, 1, "Mover"},
+		{ShipCreated, 1, "Built"},
+		{ShipDestroyed, 1, "Sunk"},
+		{SpeciesRemoved, 2, ""},
+		{ColonyCreated, 3, "Hive"},
+	}
+	r := Compare(from, to)
+	if r.FromTurn != 4 || r.ToTurn != 5 {
+		t.Errorf("turns: want 4 to 5: got %d to %d", r.FromTurn, r.ToTurn)
+	}
+	var got []change
+	for _, c := range r.Changes {
+		got = append(got, change{c.Kind, c.Species, c.Subject})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v\ngot  %v", want, got)
+	}
+
+	for _, c := range r.Changes {
+		switch c.Kind {
+		case ColonyPopulation:
+			if *c.From != 7 || *c.To != 9 {
+				t.Errorf("%s %s: want 7 -> 9: got %d -> %d", c.Kind, c.Subject, *c.From, *c.To)
+			}
+		case ShipMoved:
+			if c.FromAt.X != 1 || c.ToAt.X != 3 {
+				t.Errorf("%s %s: want x 1 -> 3: got %d -> %d", c.Kind, c.Subject, c.FromAt.X, c.ToAt.X)
+			}
+		case SpeciesRemoved:
+			if c.SpeciesName != "Beta" {
+				t.Errorf("%s: want Beta: got %q", c.Kind, c.SpeciesName)
+			}
+		}
+	}
+}
+
+func TestCompareSystemsAndPlanets(t *testing.T) {
+	system := func(x int, planets ...*fhdata.Planet) *fhdata.System {
+		s := &fhdata.System{Coords: fhdata.Coords{X: x, Y: 1, Z: 1}}
+		for _, p := range planets {
+			p.Coords, p.System = s.Coords, s
+			s.Planets = append(s.Planets, p)
+		}
+		return s
+	}
+	planet := func(orbit, md, temp, pressure int) *fhdata.Planet {
+		return &fhdata.Planet{Orbit: orbit, MiningDifficultyBase: md, TemperatureClass: temp, PressureClass: pressure}
+	}
+	alpha := func() *fhdata.Species { return &fhdata.Species{Id: 1, Name: "Alpha"} }
+	from := &fhdata.Cluster{Turn: 4, Species: []*fhdata.Species{alpha()}, Systems: []*fhdata.System{
+		system(1, planet(1, 150, 12, 9), planet(2, 400, 3, 0)),
+		system(2, planet(1, 220, 14, 11)),
+		system(3),
+	}}
+	to := &fhdata.Cluster{Turn: 5, Species: []*fhdata.Species{alpha()}, Systems: []*fhdata.System{
+		// the order of the systems doesn't matter
+		system(2, planet(1, 220, 14, 11)),
+		system(1, planet(1, 153, 12, 9), planet(2, 400, 5, 2)),
+		system(4, planet(1, 100, 1, 1)),
+	}}
+	to.Species[0].EconUnitsBanked = 10
+
+	type change struct {
+		Kind    Kind
+		Species int
+		At      string
+		From    int
+		To      int
+	}
+	want := []change{
+		{PlanetMiningDifficulty, 0, "1, 1, 1 #1", 150, 153},
+		{PlanetTemperature, 0, "1, 1, 1 #2", 3, 5},
+		{PlanetPressure, 0, "1, 1, 1 #2", 0, 2},
+		{SystemAdded, 0, "4, 1, 1", 0, 0},
+		{SystemRemoved, 0, "3, 1, 1", 0, 0},
+		{EconUnits, 1, "", 0, 10},
+	}
+	r := Compare(from, to)
+	var got []change
+	for _, c := range r.Changes {
+		ch := change{Kind: c.Kind, Species: c.Species}
+		if c.ToAt != nil {
+			ch.At = c.ToAt.String()
+		} else if c.FromAt != nil {
+			ch.At = c.FromAt.String()
+		}
+		if c.From != nil {
+			ch.From, ch.To = *c.From, *c.To
+		}
+		got = append(got, ch)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v\ngot  %v", want, got)
+	}
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"\nSystems and planets\n",
+		"  Planet at 1, 1, 1 #1 mining difficulty 150 -> 153 (+3)\n",
+		"  System at 3, 1, 1 removed\n",
+		"\nSpecies 1 Alpha\n",
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("text: want %q in\n%s", line, b.String())
+		}
+	}
+}
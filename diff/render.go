@@ -0,0 +1,114 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package diff
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteJSON writes the report as an indented JSON document.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report as plain text, one line per change,
+// with a heading for the systems and planets and for each species.
+func (r *Report) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Changes from turn %d to turn %d\n", r.FromTurn, r.ToTurn)
+	if len(r.Changes) == 0 {
+		fmt.Fprintf(bw, "\nNo changes.\n")
+	}
+	species := -1
+	for _, change := range r.Changes {
+		if change.Species != species {
+			species = change.Species
+			if species == 0 {
+				fmt.Fprintf(bw, "\nSystems and planets\n")
+			} else {
+				fmt.Fprintf(bw, "\nSpecies %d %s\n", change.Species, change.SpeciesName)
+			}
+		}
+		fmt.Fprintf(bw, "  %s\n", change)
+	}
+	return bw.Flush()
+}
+
+// String returns the change as a sentence for the text report.
+func (c *Change) String() string {
+	switch c.Kind {
+	case ColonyCreated:
+		return fmt.Sprintf("Colony %s established at %s with %d population units", c.Subject, c.ToAt, *c.To)
+	case ColonyDestroyed:
+		return fmt.Sprintf("Colony %s at %s lost", c.Subject, c.FromAt)
+	case ColonyPopulation:
+		return fmt.Sprintf("Colony %s population %d -> %d (%+d)", c.Subject, *c.From, *c.To, *c.To-*c.From)
+	case ColonyMiningBase:
+		return fmt.Sprintf("Colony %s mining base %d -> %d (%+d)", c.Subject, *c.From, *c.To, *c.To-*c.From)
+	case ColonyManufacturingBase:
+		return fmt.Sprintf("Colony %s manufacturing base %d -> %d (%+d)", c.Subject, *c.From, *c.To, *c.To-*c.From)
+	case ContactMade:
+		return fmt.Sprintf("Made contact with species %s", c.Subject)
+	case EconUnits:
+		return fmt.Sprintf("Economic units banked %d -> %d (%+d)", *c.From, *c.To, *c.To-*c.From)
+	case PlanetMiningDifficulty:
+		return fmt.Sprintf("Planet at %s mining difficulty %d -> %d (%+d)", c.ToAt, *c.From, *c.To, *c.To-*c.From)
+	case PlanetPressure:
+		return fmt.Sprintf("Planet at %s pressure class %d -> %d (%+d)", c.ToAt, *c.From, *c.To, *c.To-*c.From)
+	case PlanetTemperature:
+		return fmt.Sprintf("Planet at %s temperature class %d -> %d (%+d)", c.ToAt, *c.From, *c.To, *c.To-*c.From)
+	case ShipCreated:
+		return fmt.Sprintf("Ship %s commissioned at %s", c.Subject, c.ToAt)
+	case ShipDestroyed:
+		return fmt.Sprintf("Ship %s at %s lost", c.Subject, c.FromAt)
+	case ShipMoved:
+		return fmt.Sprintf("Ship %s moved from %s to %s", c.Subject, c.FromAt, c.ToAt)
+	case SpeciesRemoved:
+		return "Species is no longer in the cluster"
+	case SystemAdded:
+		return fmt.Sprintf("System at %s added", c.ToAt)
+	case SystemRemoved:
+		return fmt.Sprintf("System at %s removed", c.FromAt)
+	case SystemScanned:
+		return fmt.Sprintf("Scanned system at %s", c.ToAt)
+	case SystemVisited:
+		return fmt.Sprintf("Visited system at %s", c.ToAt)
+	case TechLevel:
+		return fmt.Sprintf("%s tech level %d -> %d (%+d)", c.Subject, *c.From, *c.To, *c.To-*c.From)
+	}
+	return fmt.Sprintf("%s %s", c.Kind, c.Subject)
+}
+
+// String formats the coordinates and, for planets, the orbit.
+func (l *Location) String() string {
+	if l.Orbit == 0 {
+		return fmt.Sprintf("%d, %d, %d", l.X, l.Y, l.Z)
+	}
+	return fmt.Sprintf("%d, %d, %d #%d", l.X, l.Y, l.Z, l.Orbit)
+}
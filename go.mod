@@ -1,3 +1,5 @@
 module github.com/mdhender/fhdata
 
 go 1.17
+
+require golang.org/x/crypto v0.14.0
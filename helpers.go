@@ -270,6 +270,18 @@ func codeToShipCost(code int, tonnage int) int {
 	}
 }
 
+// codeToShipMaintenancePct returns the maintenance cost per turn as a percentage of the ship's cost
+func codeToShipMaintenancePct(code int) int {
+	switch code {
+	case 16: // Starbase
+		return 10
+	case 17: // Transport
+		return 4
+	default:
+		return 20
+	}
+}
+
 // codeToShipSize returns the ship size based on class and tonnage
 func codeToShipSize(code int, tonnage int) int {
 	switch code {
@@ -371,11 +383,130 @@ func nameToString(name [32]uint8) string {
 	return string(b)
 }
 
-// speciesBitIsSet returns true if the bit is set for the species.
-// note: the species number must be 1 based!
-// sp01       65536                       1 0000 0000 0000 0000
-// sp09    16777216             1 0000 0000 0000 0000 0000 0000
-// sp18  8589934592  10 0000 0000 0000 0000 0000 0000 0000 0000
-func speciesBitIsSet(set [2]uint64, sp int) bool {
-	return (set[0] & (1 << (sp + 15))) != 0
+// namplaIndexToColony returns the species colony for a ship loading or unloading point.
+// The index is zero for none and 9999 for the home planet.
+// It returns false if the index is not one of the species' colonies.
+func namplaIndexToColony(species *Species, index int) (*Colony, bool) {
+	if index == 0 {
+		return nil, true
+	} else if index == 9999 {
+		return species.HomeColony, species.HomeColony != nil
+	} else if 0 < index && index < len(species.Colonies) {
+		return species.Colonies[index], true
+	}
+	return nil, false
+}
+
+// colonyToNamplaIndex is the inverse of namplaIndexToColony.
+func colonyToNamplaIndex(species *Species, colony *Colony) int {
+	if colony == nil {
+		return 0
+	} else if colony == species.HomeColony {
+		return 9999
+	}
+	for index, c := range species.Colonies {
+		if c == colony {
+			return index
+		}
+	}
+	return 0
+}
+
+// gasToCode returns the data file code for the gas.
+func gasToCode(gas Gas) int {
+	switch gas.Code {
+	case "H2":
+		return 1
+	case "CH4":
+		return 2
+	case "He":
+		return 3
+	case "NH3":
+		return 4
+	case "N2":
+		return 5
+	case "CO2":
+		return 6
+	case "O2":
+		return 7
+	case "HCl":
+		return 8
+	case "Cl2":
+		return 9
+	case "F2":
+		return 10
+	case "H2O":
+		return 11
+	case "SO2":
+		return 12
+	case "H2S":
+		return 13
+	default:
+		return 0
+	}
+}
+
+// itemToCode returns the data file index for the item, or -1 if the item is not known.
+func itemToCode(code string) int {
+	for i := 0; i < MAX_ITEMS; i++ {
+		if codeToItem(i, 0).Code == code {
+			return i
+		}
+	}
+	return -1
+}
+
+// shipClassToCode returns the data file code for the ship class, or -1 if the class is not known.
+func shipClassToCode(class string) int {
+	for code := 0; code <= 17; code++ {
+		if codeToShipClass(code) == class {
+			return code
+		}
+	}
+	return -1
+}
+
+// starColorToCode returns the data file code for the star color.
+func starColorToCode(color StarColor) int {
+	switch color.Code {
+	case "O":
+		return 1
+	case "B":
+		return 2
+	case "A":
+		return 3
+	case "F":
+		return 4
+	case "G":
+		return 5
+	case "K":
+		return 6
+	case "M":
+		return 7
+	default:
+		return 0
+	}
+}
+
+// starTypeToCode returns the data file code for the star type.
+func starTypeToCode(starType StarType) int {
+	switch starType.Name {
+	case "Dwarf":
+		return 1
+	case "Degenerate":
+		return 2
+	case "Main Sequence":
+		return 3
+	case "Giant":
+		return 4
+	default:
+		return 0
+	}
+}
+
+// stringToName is the inverse of nameToString.
+// the name is silently truncated if it is longer than the field.
+func stringToName(s string) (name [32]uint8) {
+	copy(name[:], s)
+	return name
 }
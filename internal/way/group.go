@@ -0,0 +1,113 @@
+package way
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Middleware wraps a handler to add behavior such as logging,
+// authentication or recovery to the routes it is used with.
+type Middleware func(http.Handler) http.Handler
+
+// chain wraps the handler in the middleware.
+// The first middleware is the outermost.
+func chain(middleware []Middleware, handler http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Use adds middleware that runs for every request, before the
+// request is routed. Path parameters are not yet in the context;
+// use a Group for middleware that needs them.
+// Use must not be called while the router is serving requests.
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+	r.handler = chain(r.middleware, http.HandlerFunc(r.route))
+}
+
+// Group calls fn with a Group for adding routes under prefix.
+// Prefix can contain path parameters.
+func (r *Router) Group(prefix string, fn func(g *Group)) {
+	fn(&Group{router: r, prefix: strings.TrimSuffix(prefix, "/")})
+}
+
+// Mount serves every path under prefix with the handler, which sees
+// the path with the prefix removed. Path parameters in the prefix are
+// passed on in the context. The handler is called for every method.
+func (r *Router) Mount(prefix string, handler http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		panic(fmt.Sprintf("way: mount %q: prefix must not be empty", prefix))
+	}
+	r.Handle("*", prefix+"/", stripSegments(len(r.pathSegments(prefix)), handler))
+}
+
+// stripSegments removes the first n segments from the cleaned path
+// before calling the handler, keeping a trailing slash.
+func stripSegments(n int, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p := cleanPath(req.URL.Path)
+		if p != "/" && strings.HasSuffix(req.URL.Path, "/") {
+			p += "/"
+		}
+		p = strings.TrimPrefix(p, "/")
+		for i := 0; i < n; i++ {
+			if j := strings.IndexByte(p, '/'); j >= 0 {
+				p = p[j+1:]
+			} else {
+				p = ""
+			}
+		}
+		r2 := new(http.Request)
+		*r2 = *req
+		r2.URL = new(url.URL)
+		*r2.URL = *req.URL
+		r2.URL.Path = "/" + p
+		r2.URL.RawPath = ""
+		handler.ServeHTTP(w, r2)
+	})
+}
+
+// Group adds routes under a common prefix, with middleware that
+// runs for those routes only. The middleware runs after the request
+// is routed, so path parameters are in the context.
+type Group struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
+}
+
+// Use adds middleware for the routes added to the group after it.
+func (g *Group) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+// Group calls fn with a nested Group, which starts with this group's
+// prefix and middleware.
+func (g *Group) Group(prefix string, fn func(g *Group)) {
+	fn(&Group{
+		router:     g.router,
+		prefix:     g.prefix + strings.TrimSuffix(prefix, "/"),
+		middleware: append([]Middleware(nil), g.middleware...),
+	})
+}
+
+// Handle adds a handler for the pattern under the group's prefix.
+func (g *Group) Handle(method, pattern string, handler http.Handler) *Route {
+	return g.router.Handle(method, g.prefix+pattern, chain(g.middleware, handler))
+}
+
+// HandleFunc is the http.HandlerFunc alternative to Handle.
+func (g *Group) HandleFunc(method, pattern string, fn http.HandlerFunc) *Route {
+	return g.Handle(method, pattern, fn)
+}
+
+// Mount serves every path under the prefix, within the group's
+// prefix, with the handler. See Router.Mount.
+func (g *Group) Mount(prefix string, handler http.Handler) {
+	g.router.Mount(g.prefix+prefix, chain(g.middleware, handler))
+}
@@ -2,7 +2,13 @@ package way
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -12,16 +18,39 @@ type wayContextKey string
 
 // Router routes HTTP requests.
 type Router struct {
-	routes []*route
+	root       *node
+	names      map[string]*Route // named routes, for URL
+	middleware []Middleware
+	handler    http.Handler // the middleware wrapped around the routing
 	// NotFound is the http.Handler to call when no routes
 	// match. By default uses http.NotFoundHandler().
 	NotFound http.Handler
+	// MethodNotAllowed is the http.Handler to call when routes
+	// match the path but not the method. The Allow header is set
+	// before it is called. By default responds with a 405.
+	MethodNotAllowed http.Handler
+	// RedirectCode is the status, http.StatusMovedPermanently or
+	// http.StatusPermanentRedirect, for redirecting requests to the
+	// canonical path of the route that matches them. The canonical
+	// path is cleaned like path.Clean, has the static segments as
+	// they were added, and ends with a slash only for prefix and
+	// *rest routes. Paths are always cleaned before matching, so
+	// when RedirectCode is zero, other paths are served as they are.
+	RedirectCode int
+	// CaseInsensitive matches static segments regardless of case.
+	// Exact matches are tried first. If static segments in the same
+	// place differ only in case, the one added first gets the rest.
+	CaseInsensitive bool
 }
 
 // NewRouter makes a new Router.
 func NewRouter() *Router {
 	return &Router{
+		root:     &node{},
 		NotFound: http.NotFoundHandler(),
+		MethodNotAllowed: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}),
 	}
 }
 
@@ -32,38 +61,237 @@ func (r *Router) pathSegments(p string) []string {
 // Handle adds a handler with the specified method and pattern.
 // Method can be any HTTP method string or "*" to match all methods.
 // Pattern can contain path segments such as: /item/:id which is
-// accessible via the Param function.
+// accessible via the Param function. A parameter can be constrained
+// with {int}, as in /item/:id{int}, or with a regular expression that
+// must match the whole segment, as in /item/:code{[a-z]+}.
+// Requests with segments that do not match the constraint do not
+// match the route.
 // If pattern ends with trailing /, it acts as a prefix.
-func (r *Router) Handle(method, pattern string, handler http.Handler) {
-	route := &route{
+// If the last segment ends with ..., it matches any segment
+// that starts with the rest of it, and everything after it.
+// If the last segment is *name, it matches the rest of the path,
+// which may be empty, and is accessible via the Param function.
+// Static segments take precedence over constrained :param segments,
+// then :param segments, then ... segments and prefixes, whatever the
+// order the routes are added in. Handle panics if the pattern conflicts
+// with an earlier one: the same pattern and method, or a :param segment
+// with the same constraint but a different name in the same place.
+func (r *Router) Handle(method, pattern string, handler http.Handler) *Route {
+	route := &Route{
+		router:  r,
 		method:  strings.ToLower(method),
-		segs:    r.pathSegments(pattern),
+		pattern: pattern,
 		handler: handler,
-		prefix:  strings.HasSuffix(pattern, "/") || strings.HasSuffix(pattern, "..."),
 	}
-	r.routes = append(r.routes, route)
+	segs := r.pathSegments(pattern)
+	n := r.root
+	for i, seg := range segs {
+		switch {
+		case strings.HasSuffix(seg, "..."):
+			if i != len(segs)-1 {
+				panic(fmt.Sprintf("way: %s: ... must be in the last segment", pattern))
+			}
+			n.partial(strings.TrimSuffix(seg, "...")).add(route)
+			return route
+		case strings.HasPrefix(seg, "*"):
+			name := strings.TrimPrefix(seg, "*")
+			if i != len(segs)-1 || strings.HasSuffix(pattern, "/") {
+				panic(fmt.Sprintf("way: %s: *%s must be the last segment", pattern, name))
+			} else if len(n.rest) != 0 && n.restName != name {
+				panic(fmt.Sprintf("way: %s: *%s conflicts with *%s", pattern, name, n.restName))
+			}
+			n.restName = name
+			n.rest.add(route)
+			return route
+		case strings.HasPrefix(seg, ":"):
+			name, c, err := parseParam(seg)
+			if err != nil {
+				panic(fmt.Sprintf("way: %s: %v", pattern, err))
+			}
+			n = n.param(name, c, pattern)
+		default:
+			if n.static == nil {
+				n.static = make(map[string]*node)
+			}
+			child, ok := n.static[seg]
+			if !ok {
+				child = &node{}
+				n.static[seg] = child
+				if n.fold == nil {
+					n.fold = make(map[string]string)
+				}
+				if _, ok := n.fold[strings.ToLower(seg)]; !ok {
+					n.fold[strings.ToLower(seg)] = seg
+				}
+			}
+			n = child
+		}
+	}
+	if strings.HasSuffix(pattern, "/") {
+		n.prefix.add(route)
+	} else {
+		n.routes.add(route)
+	}
+	return route
 }
 
 // HandleFunc is the http.HandlerFunc alternative to http.Handle.
-func (r *Router) HandleFunc(method, pattern string, fn http.HandlerFunc) {
-	r.Handle(method, pattern, fn)
+func (r *Router) HandleFunc(method, pattern string, fn http.HandlerFunc) *Route {
+	return r.Handle(method, pattern, fn)
+}
+
+// URL returns the path of the named route, with its parameters set
+// from params, which are pairs of names and values. Every parameter
+// must be given, and the values must meet the constraints.
+func (r *Router) URL(name string, params ...string) (string, error) {
+	route, ok := r.names[name]
+	if !ok {
+		return "", fmt.Errorf("way: route %q: not found", name)
+	} else if len(params)%2 != 0 {
+		return "", fmt.Errorf("way: route %q: params must be name, value pairs", name)
+	}
+	values := make(map[string]string)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+	segs := r.pathSegments(route.pattern)
+	for i, seg := range segs {
+		if strings.HasSuffix(seg, "...") {
+			return "", fmt.Errorf("way: route %q: can't build a path for %s", name, route.pattern)
+		} else if strings.HasPrefix(seg, "*") {
+			key := strings.TrimPrefix(seg, "*")
+			value, ok := values[key]
+			if !ok {
+				return "", fmt.Errorf("way: route %q: missing param %q", name, key)
+			}
+			delete(values, key)
+			parts := strings.Split(value, "/")
+			for j := range parts {
+				parts[j] = url.PathEscape(parts[j])
+			}
+			segs[i] = strings.Join(parts, "/")
+			continue
+		} else if !strings.HasPrefix(seg, ":") {
+			continue
+		}
+		key, c, _ := parseParam(seg)
+		value, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf("way: route %q: missing param %q", name, key)
+		} else if c != nil && !c.match(value) {
+			return "", fmt.Errorf("way: route %q: param %q: %q does not match {%s}", name, key, value, c.expr)
+		}
+		delete(values, key)
+		segs[i] = url.PathEscape(value)
+	}
+	for key := range values {
+		return "", fmt.Errorf("way: route %q: unknown param %q", name, key)
+	}
+	p := "/" + strings.Join(segs, "/")
+	if strings.HasSuffix(route.pattern, "/") && p != "/" {
+		p += "/"
+	}
+	return p, nil
 }
 
-// ServeHTTP routes the incoming http.Request based on method and path
-// extracting path parameters as it goes.
+// ServeHTTP runs the middleware added with Use, then routes the
+// incoming http.Request based on method and path extracting path
+// parameters as it goes.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.handler == nil {
+		r.route(w, req)
+		return
+	}
+	r.handler.ServeHTTP(w, req)
+}
+
+// route routes the incoming http.Request.
+// HEAD requests are answered by the GET route when there is no HEAD
+// route, and OPTIONS requests by listing the methods when there is no
+// OPTIONS route. When routes match the path but not the method, the
+// response is MethodNotAllowed rather than NotFound.
+func (r *Router) route(w http.ResponseWriter, req *http.Request) {
 	method := strings.ToLower(req.Method)
-	segs := r.pathSegments(req.URL.Path)
-	for _, route := range r.routes {
-		if route.method != method && route.method != "*" {
-			continue
+	cleaned := cleanPath(req.URL.Path)
+	var get *Route // the first GET route that matches, for HEAD
+	var getParams []param
+	var getPath string
+	var allowed map[string]bool // made only when a path matches without the method
+	l := &lookup{
+		fold:     r.CaseInsensitive,
+		trailing: cleaned != "/" && strings.HasSuffix(req.URL.Path, "/"),
+	}
+	l.fn = func(routes methods, params []param, canonical string) bool {
+		route, ok := routes[method]
+		if !ok {
+			route, ok = routes["*"]
+		}
+		if ok {
+			r.serve(w, req, route, params, canonical)
+			return true
 		}
-		if ctx, ok := route.match(req.Context(), r, segs); ok {
-			route.handler.ServeHTTP(w, req.WithContext(ctx))
-			return
+		if route, ok := routes["get"]; ok && get == nil {
+			get, getParams, getPath = route, append([]param(nil), params...), canonical
 		}
+		if allowed == nil {
+			allowed = make(map[string]bool)
+		}
+		for method := range routes {
+			allowed[method] = true
+		}
+		return false
+	}
+	if l.walk(r.root, r.pathSegments(cleaned), nil, nil) {
+		return
+	}
+	if len(allowed) == 0 {
+		r.NotFound.ServeHTTP(w, req)
+		return
+	}
+	if method == "head" && get != nil {
+		// the server discards the body of a response to a HEAD request
+		r.serve(w, req, get, getParams, getPath)
+		return
+	}
+	w.Header().Set("Allow", allow(allowed))
+	if method == "options" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	r.MethodNotAllowed.ServeHTTP(w, req)
+}
+
+// serve calls the route's handler, or redirects to the canonical path.
+func (r *Router) serve(w http.ResponseWriter, req *http.Request, route *Route, params []param, canonical string) {
+	if r.RedirectCode != 0 && canonical != req.URL.Path {
+		u := *req.URL
+		u.Path, u.RawPath = canonical, ""
+		http.Redirect(w, req, u.String(), r.RedirectCode)
+		return
 	}
-	r.NotFound.ServeHTTP(w, req)
+	route.handler.ServeHTTP(w, req.WithContext(withParams(req.Context(), params)))
+}
+
+// cleanPath returns the path cleaned like path.Clean, with a leading slash.
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// allow returns the value of the Allow header for the methods,
+// adding HEAD for GET and OPTIONS for every path.
+func allow(methods map[string]bool) string {
+	var list []string
+	for method := range methods {
+		list = append(list, strings.ToUpper(method))
+	}
+	if methods["get"] && !methods["head"] {
+		list = append(list, "HEAD")
+	}
+	if !methods["options"] {
+		list = append(list, "OPTIONS")
+	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
 }
 
 // Param gets the path parameter from the specified Context.
@@ -76,39 +304,212 @@ func Param(ctx context.Context, param string) string {
 	return vStr
 }
 
-type route struct {
+// ParamInt gets the path parameter from the specified Context
+// as an int. Returns an error if it is missing or not a number.
+func ParamInt(ctx context.Context, param string) (int, error) {
+	return strconv.Atoi(Param(ctx, param))
+}
+
+// Route is a route added to a Router.
+type Route struct {
+	router  *Router
 	method  string
-	segs    []string
+	pattern string
 	handler http.Handler
-	prefix  bool
 }
 
-func (r *route) match(ctx context.Context, router *Router, segs []string) (context.Context, bool) {
-	if len(segs) > len(r.segs) && !r.prefix {
-		return nil, false
+// Name names the route, for building its path with URL.
+// Name panics if the name is already taken.
+func (route *Route) Name(name string) *Route {
+	r := route.router
+	if old, ok := r.names[name]; ok {
+		panic(fmt.Sprintf("way: %s: name %q is taken by %s", route.pattern, name, old.pattern))
 	}
-	for i, seg := range r.segs {
-		if i > len(segs)-1 {
-			return nil, false
+	if r.names == nil {
+		r.names = make(map[string]*Route)
+	}
+	r.names[name] = route
+	return route
+}
+
+// methods are the routes for a path, by lower case method.
+type methods map[string]*Route
+
+func (m *methods) add(route *Route) {
+	if old, ok := (*m)[route.method]; ok {
+		panic(fmt.Sprintf("way: %s %s conflicts with %s", strings.ToUpper(route.method), route.pattern, old.pattern))
+	}
+	if *m == nil {
+		*m = make(methods)
+	}
+	(*m)[route.method] = route
+}
+
+// node is a segment in the trie of routes.
+type node struct {
+	static   map[string]*node
+	fold     map[string]string // lower-cased static keys to the first key added
+	params   []*node           // constrained first, then at most one without a constraint
+	name     string            // name of the parameter, on a param node
+	c        *constraint       // constraint on the parameter, nil for none
+	pattern  string            // the pattern that added the param node, for errors
+	partials []*partial        // ... segments, longest first
+	routes   methods           // routes that end here
+	rest     methods           // *rest routes, which match everything below
+	restName string            // name of the *rest parameter
+	prefix   methods           // routes that end here with a /, which match everything below
+}
+
+// partial is a segment ending with ..., which matches any segment that starts with prefix.
+type partial struct {
+	prefix string
+	routes methods
+}
+
+// param returns the child for the :param segment, adding it if needed.
+func (n *node) param(name string, c *constraint, pattern string) *node {
+	for _, child := range n.params {
+		if (child.c == nil) != (c == nil) || (c != nil && child.c.expr != c.expr) {
+			continue
+		} else if child.name != name {
+			panic(fmt.Sprintf("way: %s: :%s conflicts with :%s in %s", pattern, name, child.name, child.pattern))
 		}
-		isParam := false
-		if strings.HasPrefix(seg, ":") {
-			isParam = true
-			seg = strings.TrimPrefix(seg, ":")
+		return child
+	}
+	child := &node{name: name, c: c, pattern: pattern}
+	n.params = append(n.params, child)
+	sort.SliceStable(n.params, func(i, j int) bool {
+		return n.params[i].c != nil && n.params[j].c == nil
+	})
+	return child
+}
+
+// partial returns the routes for the ... segment, adding it if needed.
+func (n *node) partial(prefix string) *methods {
+	for _, p := range n.partials {
+		if p.prefix == prefix {
+			return &p.routes
 		}
-		if !isParam { // verbatim check
-			if strings.HasSuffix(seg, "...") {
-				if strings.HasPrefix(segs[i], seg[:len(seg)-3]) {
-					return ctx, true
-				}
-			}
-			if seg != segs[i] {
-				return nil, false
-			}
+	}
+	p := &partial{prefix: prefix}
+	n.partials = append(n.partials, p)
+	sort.SliceStable(n.partials, func(i, j int) bool {
+		return len(n.partials[i].prefix) > len(n.partials[j].prefix)
+	})
+	return &p.routes
+}
+
+// lookup finds the routes in the trie that match a path.
+type lookup struct {
+	fold     bool // match static segments regardless of case
+	trailing bool // the path ends with a slash
+	// fn is called with the routes for each path in the trie that
+	// matches, most specific first, until it returns true.
+	fn func(routes methods, params []param, canonical string) bool
+}
+
+// walk matches segs against the node's children. path holds the
+// canonical segments matched so far.
+func (l *lookup) walk(n *node, segs []string, params []param, path []string) bool {
+	if len(segs) == 0 {
+		if len(n.routes) != 0 && l.fn(n.routes, params, canonical(path, false)) {
+			return true
+		}
+		if len(n.rest) != 0 && l.fn(n.rest, append(params, param{n.restName, ""}), canonical(path, true)) {
+			return true
+		}
+		return len(n.prefix) != 0 && l.fn(n.prefix, params, canonical(path, true))
+	}
+	seg := segs[0]
+	if child, key, ok := n.child(seg, l.fold); ok && l.walk(child, segs[1:], params, append(path, key)) {
+		return true
+	}
+	for _, child := range n.params {
+		if (child.c == nil || child.c.match(seg)) && l.walk(child, segs[1:], append(params, param{child.name, seg}), append(path, seg)) {
+			return true
 		}
-		if isParam {
-			ctx = context.WithValue(ctx, wayContextKey(seg), segs[i])
+	}
+	// the rest of the path is kept as it is
+	open := canonical(append(path, segs...), l.trailing)
+	for _, p := range n.partials {
+		if strings.HasPrefix(seg, p.prefix) && len(p.routes) != 0 && l.fn(p.routes, params, open) {
+			return true
+		}
+	}
+	if len(n.rest) != 0 {
+		value := strings.Join(segs, "/")
+		if l.trailing {
+			value += "/"
+		}
+		if l.fn(n.rest, append(params, param{n.restName, value}), open) {
+			return true
 		}
 	}
-	return ctx, true
+	return len(n.prefix) != 0 && l.fn(n.prefix, params, open)
+}
+
+// child returns the static child for the segment and its key,
+// trying an exact match first.
+func (n *node) child(seg string, fold bool) (*node, string, bool) {
+	if child, ok := n.static[seg]; ok || !fold {
+		return child, seg, ok
+	}
+	key, ok := n.fold[strings.ToLower(seg)]
+	return n.static[key], key, ok
+}
+
+// canonical joins the segments into a path.
+func canonical(segs []string, slash bool) string {
+	p := "/" + strings.Join(segs, "/")
+	if slash && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return p
+}
+
+// param is a path parameter and its value.
+type param struct {
+	name  string
+	value string
+}
+
+func withParams(ctx context.Context, params []param) context.Context {
+	for _, p := range params {
+		ctx = context.WithValue(ctx, wayContextKey(p.name), p.value)
+	}
+	return ctx
+}
+
+// constraint restricts the values of a path parameter.
+type constraint struct {
+	expr string
+	re   *regexp.Regexp // nil for int
+}
+
+func (c *constraint) match(value string) bool {
+	if c.re == nil {
+		_, err := strconv.Atoi(value)
+		return err == nil
+	}
+	return c.re.MatchString(value)
+}
+
+// parseParam splits a :name{constraint} segment.
+func parseParam(seg string) (name string, c *constraint, err error) {
+	name = strings.TrimPrefix(seg, ":")
+	i := strings.IndexByte(name, '{')
+	if i < 0 {
+		return name, nil, nil
+	} else if !strings.HasSuffix(name, "}") {
+		return "", nil, fmt.Errorf("%s: constraint must end with }", seg)
+	}
+	name, expr := name[:i], name[i+1:len(name)-1]
+	if expr == "int" {
+		return name, &constraint{expr: expr}, nil
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", seg, err)
+	}
+	return name, &constraint{expr: expr, re: re}, nil
 }
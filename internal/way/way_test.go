@@ -0,0 +1,662 @@
+package way
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tagged returns a handler that writes the tag, for checking which route ran.
+func tagged(tag string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(tag))
+	}
+}
+
+// serve returns the response to the request.
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestMethods(t *testing.T) {
+	r := NewRouter()
+	r.HandleFunc("GET", "/planets", tagged("get planets"))
+	r.HandleFunc("GET", "/login", tagged("get login"))
+	r.HandleFunc("POST", "/login", tagged("post login"))
+	r.HandleFunc("*", "/any", tagged("any"))
+	r.HandleFunc("GET", "/own", tagged("get own"))
+	r.HandleFunc("HEAD", "/own", tagged("head own"))
+	r.HandleFunc("OPTIONS", "/own", tagged("options own"))
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+		allow        string
+		body         string
+	}{
+		{"GET", "/planets", http.StatusOK, "", "get planets"},
+		{"POST", "/planets", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS", ""},
+		{"DELETE", "/login", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, POST", ""},
+		{"POST", "/login", http.StatusOK, "", "post login"},
+		{"HEAD", "/planets", http.StatusOK, "", "get planets"},
+		{"OPTIONS", "/planets", http.StatusNoContent, "GET, HEAD, OPTIONS", ""},
+		{"OPTIONS", "/login", http.StatusNoContent, "GET, HEAD, OPTIONS, POST", ""},
+		{"PATCH", "/any", http.StatusOK, "", "any"},
+		{"OPTIONS", "/any", http.StatusOK, "", "any"},
+		{"HEAD", "/own", http.StatusOK, "", "head own"},
+		{"OPTIONS", "/own", http.StatusOK, "", "options own"},
+		{"PUT", "/own", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS", ""},
+		{"GET", "/missing", http.StatusNotFound, "", ""},
+		{"POST", "/missing", http.StatusNotFound, "", ""},
+	} {
+		w := serve(r, tc.method, tc.path)
+		if w.Code != tc.code {
+			t.Errorf("%s %s: code: want %d: got %d", tc.method, tc.path, tc.code, w.Code)
+		}
+		if got := w.Header().Get("Allow"); got != tc.allow {
+			t.Errorf("%s %s: Allow: want %q: got %q", tc.method, tc.path, tc.allow, got)
+		}
+		if tc.body != "" && w.Body.String() != tc.body {
+			t.Errorf("%s %s: body: want %q: got %q", tc.method, tc.path, tc.body, w.Body.String())
+		}
+	}
+}
+
+func TestMethodNotAllowedHandler(t *testing.T) {
+	r := NewRouter()
+	r.HandleFunc("GET", "/planets", tagged("get planets"))
+	r.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("allow " + w.Header().Get("Allow")))
+	})
+	w := serve(r, "POST", "/planets")
+	if w.Code != http.StatusTeapot || w.Body.String() != "allow GET, HEAD, OPTIONS" {
+		t.Errorf("want %d %q: got %d %q", http.StatusTeapot, "allow GET, HEAD, OPTIONS", w.Code, w.Body.String())
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	// each route is added in both orders; the same one must win
+	for _, tc := range []struct {
+		first, second string // patterns
+		path          string
+		want          string // the pattern that should win
+	}{
+		{"/a/:id", "/a/new", "/a/new", "/a/new"},
+		{"/a/:id", "/a/new", "/a/5", "/a/:id"},
+		{"/a/...", "/a/:id", "/a/5", "/a/:id"},
+		{"/a/", "/a/:id", "/a/5", "/a/:id"},
+		{"/a/", "/a/:id", "/a/5/6", "/a/"},
+		{"/a/", "/a/new", "/a/new", "/a/new"},
+		{"/a/n...", "/a/new", "/a/new", "/a/new"},
+		{"/a/n...", "/a/", "/a/news", "/a/n..."},
+		{"/a/:id/b", "/a/new/:id", "/a/new/b", "/a/new/:id"},
+		{"/a/:id/b", "/a/new/:id", "/a/old/b", "/a/:id/b"},
+		{"/a/:id/b", "/a/new/", "/a/new/b", "/a/new/"},
+	} {
+		for _, order := range [][2]string{{tc.first, tc.second}, {tc.second, tc.first}} {
+			r := NewRouter()
+			for _, pattern := range order {
+				r.HandleFunc("GET", pattern, tagged(pattern))
+			}
+			if got := serve(r, "GET", tc.path).Body.String(); got != tc.want {
+				t.Errorf("%s then %s: GET %s: want %q: got %q", order[0], order[1], tc.path, tc.want, got)
+			}
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	r := NewRouter()
+	r.HandleFunc("GET", "/specie/:id/ship/:sid", func(w http.ResponseWriter, req *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s", Param(req.Context(), "id"), Param(req.Context(), "sid"))
+	})
+	if got := serve(r, "GET", "/specie/3/ship/14").Body.String(); got != "3 14" {
+		t.Errorf("want %q: got %q", "3 14", got)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	for _, tc := range []struct {
+		first, second [2]string // method and pattern
+		want          string    // in the panic message
+	}{
+		{[2]string{"GET", "/a/b"}, [2]string{"GET", "/a/b"}, "GET /a/b conflicts with /a/b"},
+		{[2]string{"GET", "/a/:id"}, [2]string{"get", "/a/:id"}, "GET /a/:id conflicts with /a/:id"},
+		{[2]string{"*", "/a/"}, [2]string{"*", "/a/"}, "* /a/ conflicts with /a/"},
+		{[2]string{"GET", "/x..."}, [2]string{"GET", "/x..."}, "GET /x... conflicts with /x..."},
+		{[2]string{"GET", "/a/:a"}, [2]string{"GET", "/a/:b"}, ":b conflicts with :a in /a/:a"},
+		{[2]string{"GET", "/a/:a/x"}, [2]string{"POST", "/a/:b/y"}, ":b conflicts with :a in /a/:a/x"},
+	} {
+		got := func() (msg string) {
+			defer func() {
+				msg = fmt.Sprint(recover())
+			}()
+			r := NewRouter()
+			r.HandleFunc(tc.first[0], tc.first[1], tagged(""))
+			r.HandleFunc(tc.second[0], tc.second[1], tagged(""))
+			return ""
+		}()
+		if !strings.Contains(got, tc.want) {
+			t.Errorf("%v then %v: want panic %q: got %q", tc.first, tc.second, tc.want, got)
+		}
+	}
+
+	// the same param in the same place, and other methods, are not conflicts
+	r := NewRouter()
+	r.HandleFunc("GET", "/a/:id/b", tagged(""))
+	r.HandleFunc("GET", "/a/:id/c", tagged(""))
+	r.HandleFunc("POST", "/a/:id/c", tagged(""))
+}
+
+// sliceRouter is the matcher the trie replaced, which tries every
+// route in the order they were added. It is kept for the benchmarks.
+type sliceRouter struct {
+	routes []*sliceRoute
+}
+
+type sliceRoute struct {
+	method  string
+	segs    []string
+	handler http.Handler
+	prefix  bool
+}
+
+func (r *sliceRouter) Handle(method, pattern string, handler http.Handler) {
+	r.routes = append(r.routes, &sliceRoute{
+		method:  strings.ToLower(method),
+		segs:    strings.Split(strings.Trim(pattern, "/"), "/"),
+		handler: handler,
+		prefix:  strings.HasSuffix(pattern, "/") || strings.HasSuffix(pattern, "..."),
+	})
+}
+
+func (r *sliceRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	method := strings.ToLower(req.Method)
+	segs := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for _, route := range r.routes {
+		if route.method != method && route.method != "*" {
+			continue
+		}
+		if ctx, ok := route.match(req.Context(), segs); ok {
+			route.handler.ServeHTTP(w, req.WithContext(ctx))
+			return
+		}
+	}
+	http.NotFound(w, req)
+}
+
+func (r *sliceRoute) match(ctx context.Context, segs []string) (context.Context, bool) {
+	if len(segs) > len(r.segs) && !r.prefix {
+		return nil, false
+	}
+	for i, seg := range r.segs {
+		if i > len(segs)-1 {
+			return nil, false
+		}
+		if strings.HasPrefix(seg, ":") {
+			ctx = context.WithValue(ctx, wayContextKey(strings.TrimPrefix(seg, ":")), segs[i])
+			continue
+		}
+		if strings.HasSuffix(seg, "...") && strings.HasPrefix(segs[i], seg[:len(seg)-3]) {
+			return ctx, true
+		}
+		if seg != segs[i] {
+			return nil, false
+		}
+	}
+	return ctx, true
+}
+
+// benchPatterns are the server's routes, plus extras to show how
+// each matcher grows with the number of routes.
+func benchPatterns(extra int) []string {
+	var patterns []string
+	for _, prefix := range []string{"/api/v1", "/api/v1/turns/:n"} {
+		for _, p := range []string{"/planets", "/planets/:id", "/species", "/species/:id", "/species/:id/colonies",
+			"/species/:id/colonies/:cid", "/species/:id/ships", "/species/:id/ships/:sid", "/systems", "/systems/:id"} {
+			patterns = append(patterns, prefix+p)
+		}
+	}
+	for _, prefix := range []string{"", "/turn/:n"} {
+		for _, p := range []string{"/home", "/planets", "/planet/:id", "/species", "/specie/:id", "/specie/:id/colony/:cid",
+			"/specie/:id/maintenance", "/specie/:id/ship/:sid", "/systems", "/system/:id"} {
+			patterns = append(patterns, prefix+p)
+		}
+	}
+	for i := 0; i < extra; i++ {
+		patterns = append(patterns, fmt.Sprintf("/extra%d/:id/thing", i))
+	}
+	return patterns
+}
+
+func benchmarkRouter(b *testing.B, h interface {
+	Handle(method, pattern string, handler http.Handler)
+}, extra int, target string) {
+	nop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for _, pattern := range benchPatterns(extra) {
+		h.Handle("GET", pattern, nop)
+	}
+	req := httptest.NewRequest("GET", target, nil)
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.(http.Handler).ServeHTTP(w, req)
+	}
+}
+
+// trieRouter adapts Router to the interface the benchmarks use.
+type trieRouter struct {
+	*Router
+}
+
+func (r trieRouter) Handle(method, pattern string, handler http.Handler) {
+	r.Router.Handle(method, pattern, handler)
+}
+
+func BenchmarkTrie(b *testing.B) {
+	benchmarkRouter(b, trieRouter{NewRouter()}, 0, "/turn/12/specie/3/ship/44")
+}
+
+func BenchmarkSlice(b *testing.B) {
+	benchmarkRouter(b, &sliceRouter{}, 0, "/turn/12/specie/3/ship/44")
+}
+
+func BenchmarkTrieManyRoutes(b *testing.B) {
+	benchmarkRouter(b, trieRouter{NewRouter()}, 500, "/extra499/3/thing")
+}
+
+func BenchmarkSliceManyRoutes(b *testing.B) {
+	benchmarkRouter(b, &sliceRouter{}, 500, "/extra499/3/thing")
+}
+
+func TestConstraints(t *testing.T) {
+	r := NewRouter()
+	param := func(tag string) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			_, _ = fmt.Fprintf(w, "%s %s", tag, Param(req.Context(), "id"))
+		}
+	}
+	r.HandleFunc("GET", "/a/:id{int}", param("int"))
+	r.HandleFunc("GET", "/a/:id", param("any"))
+	r.HandleFunc("GET", "/b/:id{int}", param("int"))
+	r.HandleFunc("GET", "/c/:id{[a-z]{2}}", param("code"))
+
+	for _, tc := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/a/12", http.StatusOK, "int 12"},
+		{"/a/-3", http.StatusOK, "int -3"},
+		{"/a/x", http.StatusOK, "any x"},
+		{"/b/12", http.StatusOK, "int 12"},
+		{"/b/x", http.StatusNotFound, ""},
+		{"/b/1x", http.StatusNotFound, ""},
+		{"/c/ab", http.StatusOK, "code ab"},
+		{"/c/abc", http.StatusNotFound, ""},
+		{"/c/AB", http.StatusNotFound, ""},
+	} {
+		w := serve(r, "GET", tc.path)
+		if w.Code != tc.code {
+			t.Errorf("GET %s: code: want %d: got %d", tc.path, tc.code, w.Code)
+		} else if tc.body != "" && w.Body.String() != tc.body {
+			t.Errorf("GET %s: body: want %q: got %q", tc.path, tc.body, w.Body.String())
+		}
+	}
+
+	for _, pattern := range []string{"/d/:id{[}", "/d/:id{int"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: want panic", pattern)
+				}
+			}()
+			NewRouter().HandleFunc("GET", pattern, tagged(""))
+		}()
+	}
+}
+
+func TestParamInt(t *testing.T) {
+	ctx := context.WithValue(context.Background(), wayContextKey("id"), "42")
+	ctx = context.WithValue(ctx, wayContextKey("name"), "x")
+	if n, err := ParamInt(ctx, "id"); err != nil || n != 42 {
+		t.Errorf("id: want 42, nil: got %d, %v", n, err)
+	}
+	if _, err := ParamInt(ctx, "name"); err == nil {
+		t.Errorf("name: want error")
+	}
+	if _, err := ParamInt(ctx, "missing"); err == nil {
+		t.Errorf("missing: want error")
+	}
+}
+
+func TestURL(t *testing.T) {
+	r := NewRouter()
+	r.HandleFunc("GET", "/", tagged("")).Name("root")
+	r.HandleFunc("GET", "/specie/:id{int}/ship/:sid{int}", tagged("")).Name("ship")
+	r.HandleFunc("GET", "/c/:code{[a-z]+}", tagged("")).Name("code")
+	r.HandleFunc("GET", "/p/:name/", tagged("")).Name("prefix")
+	r.HandleFunc("GET", "/s...", tagged("")).Name("partial")
+
+	for _, tc := range []struct {
+		name   string
+		params []string
+		want   string
+		err    string
+	}{
+		{"root", nil, "/", ""},
+		{"ship", []string{"id", "3", "sid", "14"}, "/specie/3/ship/14", ""},
+		{"ship", []string{"sid", "14", "id", "3"}, "/specie/3/ship/14", ""},
+		{"code", []string{"code", "abc"}, "/c/abc", ""},
+		{"prefix", []string{"name", "a b/c"}, "/p/a%20b%2Fc/", ""},
+		{"ship", []string{"id", "x", "sid", "14"}, "", `param "id": "x" does not match {int}`},
+		{"code", []string{"code", "ABC"}, "", `"ABC" does not match {[a-z]+}`},
+		{"ship", []string{"id", "3"}, "", `missing param "sid"`},
+		{"ship", []string{"id", "3", "sid", "14", "x", "1"}, "", `unknown param "x"`},
+		{"ship", []string{"id"}, "", "name, value pairs"},
+		{"nope", nil, "", `route "nope": not found`},
+		{"partial", nil, "", "can't build a path"},
+	} {
+		got, err := r.URL(tc.name, tc.params...)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s %v: want error %q: got %q, %v", tc.name, tc.params, tc.err, got, err)
+			}
+		} else if err != nil || got != tc.want {
+			t.Errorf("%s %v: want %q: got %q, %v", tc.name, tc.params, tc.want, got, err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("duplicate name: want panic")
+		}
+	}()
+	r.HandleFunc("POST", "/", tagged("")).Name("root")
+}
+
+func TestRedirects(t *testing.T) {
+	for _, code := range []int{http.StatusMovedPermanently, http.StatusPermanentRedirect} {
+		r := NewRouter()
+		r.RedirectCode = code
+		r.HandleFunc("GET", "/planets", tagged("planets"))
+		r.HandleFunc("POST", "/planets/:id", tagged("planet"))
+		r.HandleFunc("GET", "/static/", tagged("static"))
+		r.HandleFunc("GET", "/files/*path", tagged("files"))
+		for _, tc := range []struct {
+			method, target string
+			location       string // empty when the route is served
+			body           string
+		}{
+			{"GET", "/planets", "", "planets"},
+			{"GET", "/planets/", "/planets", ""},
+			{"GET", "//planets", "/planets", ""},
+			{"GET", "/a/../planets", "/planets", ""},
+			{"GET", "/./planets?sort=name", "/planets?sort=name", ""},
+			{"POST", "/planets//3", "/planets/3", ""},
+			{"GET", "/static", "/static/", ""},
+			{"GET", "/static/", "", "static"},
+			{"GET", "/static//a//b", "/static/a/b", ""},
+			{"GET", "/files", "/files/", ""},
+			{"GET", "/files/a//b", "/files/a/b", ""},
+			{"GET", "/files/a/b/", "", "files"},
+		} {
+			w := serve(r, tc.method, tc.target)
+			if tc.location == "" {
+				if w.Code != http.StatusOK || w.Body.String() != tc.body {
+					t.Errorf("%d: %s %s: want 200 %q: got %d %q", code, tc.method, tc.target, tc.body, w.Code, w.Body.String())
+				}
+			} else if w.Code != code || w.Header().Get("Location") != tc.location {
+				t.Errorf("%d: %s %s: want %d %q: got %d %q", code, tc.method, tc.target, code, tc.location, w.Code, w.Header().Get("Location"))
+			}
+		}
+	}
+
+	// without a redirect code, the cleaned path is served as it is
+	r := NewRouter()
+	r.HandleFunc("GET", "/planets", tagged("planets"))
+	if w := serve(r, "GET", "//planets/"); w.Code != http.StatusOK || w.Body.String() != "planets" {
+		t.Errorf("GET //planets/: want 200 %q: got %d %q", "planets", w.Code, w.Body.String())
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	for _, fold := range []bool{false, true} {
+		r := NewRouter()
+		r.CaseInsensitive = fold
+		r.RedirectCode = http.StatusPermanentRedirect
+		r.HandleFunc("GET", "/planets/:name", func(w http.ResponseWriter, req *http.Request) {
+			_, _ = w.Write([]byte(Param(req.Context(), "name")))
+		})
+		r.HandleFunc("GET", "/Species", tagged("species"))
+		for _, tc := range []struct {
+			target   string
+			code     int
+			location string
+			body     string
+		}{
+			{"/planets/Mars", http.StatusOK, "", "Mars"},
+			{"/Species", http.StatusOK, "", "species"},
+			{"/PLANETS/Mars", http.StatusPermanentRedirect, "/planets/Mars", ""},
+			{"/species", http.StatusPermanentRedirect, "/Species", ""},
+		} {
+			code, location := tc.code, tc.location
+			if !fold && tc.code != http.StatusOK {
+				code, location = http.StatusNotFound, ""
+			}
+			w := serve(r, "GET", tc.target)
+			if w.Code != code || w.Header().Get("Location") != location || (tc.body != "" && w.Body.String() != tc.body) {
+				t.Errorf("fold %v: GET %s: want %d %q %q: got %d %q %q", fold, tc.target,
+					code, location, tc.body, w.Code, w.Header().Get("Location"), w.Body.String())
+			}
+		}
+	}
+}
+
+func TestCaseInsensitiveCollision(t *testing.T) {
+	r := NewRouter()
+	r.CaseInsensitive = true
+	r.HandleFunc("GET", "/About", tagged("About"))
+	r.HandleFunc("GET", "/ABOUT", tagged("ABOUT"))
+	r.HandleFunc("GET", "/aBout", tagged("aBout"))
+	for _, tc := range []struct {
+		target string
+		body   string
+	}{
+		{"/About", "About"},
+		{"/ABOUT", "ABOUT"},
+		{"/aBout", "aBout"},
+		// the first one added gets the rest, every time
+		{"/about", "About"},
+		{"/abouT", "About"},
+	} {
+		for i := 0; i < 20; i++ {
+			if w := serve(r, "GET", tc.target); w.Code != http.StatusOK || w.Body.String() != tc.body {
+				t.Errorf("GET %s: want 200 %q: got %d %q", tc.target, tc.body, w.Code, w.Body.String())
+				break
+			}
+		}
+	}
+}
+
+func TestRest(t *testing.T) {
+	r := NewRouter()
+	r.HandleFunc("GET", "/files/*path", func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("files " + Param(req.Context(), "path")))
+	})
+	r.HandleFunc("GET", "/files/index", tagged("index"))
+	r.HandleFunc("GET", "/docs/:lang/*page", func(w http.ResponseWriter, req *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s", Param(req.Context(), "lang"), Param(req.Context(), "page"))
+	}).Name("docs")
+	for _, tc := range []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/files", http.StatusOK, "files "},
+		{"/files/", http.StatusOK, "files "},
+		{"/files/a", http.StatusOK, "files a"},
+		{"/files/a/b/c.txt", http.StatusOK, "files a/b/c.txt"},
+		{"/files/a/b/", http.StatusOK, "files a/b/"},
+		{"/files/index", http.StatusOK, "index"},
+		{"/files/index/x", http.StatusOK, "files index/x"},
+		{"/docs/en/intro/start", http.StatusOK, "en intro/start"},
+		{"/docs", http.StatusNotFound, ""},
+	} {
+		w := serve(r, "GET", tc.target)
+		if w.Code != tc.code || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("GET %s: want %d %q: got %d %q", tc.target, tc.code, tc.body, w.Code, w.Body.String())
+		}
+	}
+
+	for _, tc := range []struct {
+		page, want string
+	}{
+		{"intro/start", "/docs/en/intro/start"},
+		{"a b/c", "/docs/en/a%20b/c"},
+		{"", "/docs/en/"},
+	} {
+		if got, err := r.URL("docs", "lang", "en", "page", tc.page); err != nil || got != tc.want {
+			t.Errorf("URL docs %q: want %q: got %q, %v", tc.page, tc.want, got, err)
+		}
+	}
+
+	for _, pattern := range []string{"/x/*rest/y", "/x/*rest/"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: want panic", pattern)
+				}
+			}()
+			NewRouter().HandleFunc("GET", pattern, tagged(""))
+		}()
+	}
+}
+
+func TestMount(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s", req.URL.Path, Param(req.Context(), "turn"))
+	})
+	r := NewRouter()
+	r.Mount("/mnt", echo)
+	r.Mount("/turn/:turn/files", echo)
+	for _, tc := range []struct {
+		target string
+		body   string
+	}{
+		{"/mnt/", "/ "},
+		{"/mnt/a/b", "/a/b "},
+		{"/mnt/a/b/", "/a/b/ "},
+		{"//mnt//a/b", "/a/b "},
+		{"/mnt/x/../a", "/a "},
+		{"/turn/3/files/map.png", "/map.png 3"},
+		{"/turn//3/files//map.png", "/map.png 3"},
+	} {
+		w := serve(r, "GET", tc.target)
+		if w.Code != http.StatusOK || w.Body.String() != tc.body {
+			t.Errorf("GET %s: want 200 %q: got %d %q", tc.target, tc.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+// traced returns middleware that adds its name to the X-Trace header before
+// calling the next handler, for checking which middleware ran and in what order.
+func traced(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := NewRouter()
+	r.Use(traced("r1"), traced("r2"))
+	r.HandleFunc("GET", "/top", tagged("top"))
+	r.Group("/g/", func(g *Group) {
+		g.Use(traced("g1"))
+		g.Use(traced("g2"))
+		g.HandleFunc("GET", "/x", tagged("x"))
+		g.Group("/n", func(n *Group) {
+			n.Use(traced("n1"))
+			n.HandleFunc("GET", "/y", tagged("y"))
+		})
+		// middleware added later does not wrap the routes already added
+		g.Use(traced("g3"))
+		g.HandleFunc("GET", "/z", tagged("z"))
+		g.Group("/m", func(m *Group) {
+			m.HandleFunc("GET", "/w", tagged("w"))
+		})
+	})
+	r.Group("/h", func(h *Group) {
+		h.HandleFunc("GET", "/x", tagged("hx"))
+	})
+	for _, tc := range []struct {
+		target string
+		code   int
+		trace  string
+		body   string
+	}{
+		{"/top", http.StatusOK, "r1 r2", "top"},
+		{"/g/x", http.StatusOK, "r1 r2 g1 g2", "x"},
+		{"/g/n/y", http.StatusOK, "r1 r2 g1 g2 n1", "y"},
+		{"/g/z", http.StatusOK, "r1 r2 g1 g2 g3", "z"},
+		{"/g/m/w", http.StatusOK, "r1 r2 g1 g2 g3", "w"},
+		{"/h/x", http.StatusOK, "r1 r2", "hx"},
+		// the router's middleware runs before routing, so it sees requests that don't match
+		{"/missing", http.StatusNotFound, "r1 r2", ""},
+	} {
+		w := serve(r, "GET", tc.target)
+		trace := strings.Join(w.Header().Values("X-Trace"), " ")
+		if w.Code != tc.code || trace != tc.trace || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("GET %s: want %d %q %q: got %d %q %q", tc.target, tc.code, tc.trace, tc.body, w.Code, trace, w.Body.String())
+		}
+	}
+}
+
+func TestGroupParams(t *testing.T) {
+	param := func(tag string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				_, _ = fmt.Fprintf(w, "%s=%s ", tag, Param(req.Context(), "turn"))
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+	echo := func(w http.ResponseWriter, req *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s", Param(req.Context(), "id"), req.URL.Path)
+	}
+	r := NewRouter()
+	// path parameters are not in the context before routing
+	r.Use(param("router"))
+	r.Group("/turn/:turn", func(g *Group) {
+		g.Use(param("group"))
+		g.HandleFunc("GET", "/species/:id", echo)
+		g.Group("/ships/:id", func(n *Group) {
+			n.Use(param("nested"))
+			n.HandleFunc("GET", "/cargo", echo)
+		})
+		g.Mount("/files", http.HandlerFunc(echo))
+	})
+	for _, tc := range []struct {
+		target string
+		body   string
+	}{
+		{"/turn/3/species/7", "router= group=3 7 /turn/3/species/7"},
+		{"/turn/4/ships/12/cargo", "router= group=4 nested=4 12 /turn/4/ships/12/cargo"},
+		{"/turn/5/files/map.png", "router= group=5  /map.png"},
+	} {
+		w := serve(r, "GET", tc.target)
+		if w.Code != http.StatusOK || w.Body.String() != tc.body {
+			t.Errorf("GET %s: want 200 %q: got %d %q", tc.target, tc.body, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Layout is the byte order and the record sizes of a set of data files.
+// The record sizes depend on the compiler that built the engine.
+// The differences are in the padding at the end of the records, so records
+// that are longer than the Go structs are truncated when read and records
+// that are shorter are zero-filled.
+type Layout struct {
+	ByteOrder   binary.ByteOrder
+	StarSize    int
+	PlanetSize  int
+	SpeciesSize int
+	NamplaSize  int
+	ShipSize    int
+}
+
+// NewLayout returns a layout with the given byte order and the record sizes of the Go structs.
+func NewLayout(bo binary.ByteOrder) *Layout {
+	return &Layout{
+		ByteOrder:   bo,
+		StarSize:    binary.Size(star_data{}),
+		PlanetSize:  binary.Size(planet_data{}),
+		SpeciesSize: binary.Size(species_data{}),
+		NamplaSize:  binary.Size(nampla_data{}),
+		ShipSize:    binary.Size(ship_data{}),
+	}
+}
+
+func (l *Layout) String() string {
+	return fmt.Sprintf("%s, stars %d, planets %d, species %d, namplas %d, ships %d", l.ByteOrder, l.StarSize, l.PlanetSize, l.SpeciesSize, l.NamplaSize, l.ShipSize)
+}
+
+// ErrUnknownLayout is returned when the data files don't match any known layout.
+var ErrUnknownLayout = errors.New("unknown data file layout")
+
+// layoutSizes returns the candidate record sizes for a record, most likely first.
+// The candidates are the size of the Go struct, the size without the trailing
+// padding that the struct adds, and the size rounded up to eight bytes.
+func layoutSizes(size, padding int) []int {
+	sizes := []int{size}
+	if padding != 0 {
+		sizes = append(sizes, size-padding)
+	}
+	if size%8 != 0 {
+		sizes = append(sizes, size+8-size%8)
+	}
+	return sizes
+}
+
+// DetectLayout probes the galaxy, stars, planets, and species files in the given path
+// and returns the byte order and record sizes that are consistent with all of them.
+func DetectLayout(dataPath string) (*Layout, error) {
+	layout, err := DetectLayoutFS(os.DirFS(dataPath))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dataPath, err)
+	}
+	return layout, nil
+}
+
+// DetectLayoutFS is DetectLayout for files in a file system.
+func DetectLayoutFS(fsys fs.FS) (*Layout, error) {
+	galaxy, err := readHeader(fsys, "galaxy.dat", 16)
+	if err != nil {
+		return nil, err
+	}
+	stars, err := readHeader(fsys, "stars.dat", 4)
+	if err != nil {
+		return nil, err
+	}
+	planets, err := readHeader(fsys, "planets.dat", 4)
+	if err != nil {
+		return nil, err
+	}
+
+	var rejected []error
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		layout, err := probeLayout(fsys, bo, galaxy, stars, planets)
+		if err == nil {
+			return layout, nil
+		}
+		rejected = append(rejected, fmt.Errorf("%s: %w", bo, err))
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnknownLayout, rejected)
+}
+
+// probeLayout returns the layout for the given byte order or an error if the files don't fit it.
+func probeLayout(fsys fs.FS, bo binary.ByteOrder, galaxy, stars, planets *fileHeader) (*Layout, error) {
+	layout := NewLayout(bo)
+
+	numSpecies := int32(bo.Uint32(galaxy.data[4:]))
+	if radius := int32(bo.Uint32(galaxy.data[8:])); !(0 < radius && radius < 128) {
+		return nil, fmt.Errorf("galaxy.dat: radius %d is not valid", radius)
+	} else if turn := int32(bo.Uint32(galaxy.data[12:])); turn < 0 {
+		return nil, fmt.Errorf("galaxy.dat: turn %d is not valid", turn)
+	} else if !(0 <= numSpecies && numSpecies <= MAX_SPECIES) {
+		return nil, fmt.Errorf("galaxy.dat: number of species %d is not valid", numSpecies)
+	}
+
+	var ok bool
+	if layout.StarSize, ok = stars.recordSize(bo, layoutSizes(layout.StarSize, 2)); !ok {
+		return nil, fmt.Errorf("stars.dat: size %d does not match %d stars", stars.size, int32(bo.Uint32(stars.data)))
+	}
+	if layout.PlanetSize, ok = planets.recordSize(bo, layoutSizes(layout.PlanetSize, 0)); !ok {
+		return nil, fmt.Errorf("planets.dat: size %d does not match %d planets", planets.size, int32(bo.Uint32(planets.data)))
+	}
+
+	// the species files share the nampla and ship sizes, so find the combination that fits every file.
+	// a species with no ships can't tell us the ship size, so we keep the first candidate that fits.
+	type candidate struct{ species, namplas, ships int }
+	var candidates []candidate
+	for _, species := range layoutSizes(layout.SpeciesSize, 0) {
+		for _, namplas := range layoutSizes(layout.NamplaSize, 0) {
+			for _, ships := range layoutSizes(layout.ShipSize, 2) {
+				candidates = append(candidates, candidate{species, namplas, ships})
+			}
+		}
+	}
+	for spNo := 1; spNo <= int(numSpecies); spNo++ {
+		name := fmt.Sprintf("sp%02d.dat", spNo)
+		sp, err := readHeader(fsys, name, speciesCountsOffset+8)
+		if err != nil {
+			return nil, err
+		}
+		numNamplas := int64(int32(bo.Uint32(sp.data[speciesCountsOffset:])))
+		numShips := int64(int32(bo.Uint32(sp.data[speciesCountsOffset+4:])))
+		var fits []candidate
+		for _, c := range candidates {
+			if numNamplas >= 0 && numShips >= 0 && int64(c.species)+numNamplas*int64(c.namplas)+numShips*int64(c.ships) == sp.size {
+				fits = append(fits, c)
+			}
+		}
+		if len(fits) == 0 {
+			return nil, fmt.Errorf("%s: size %d does not match %d namplas and %d ships", name, sp.size, numNamplas, numShips)
+		}
+		candidates = fits
+	}
+	if len(candidates) != 0 {
+		layout.SpeciesSize, layout.NamplaSize, layout.ShipSize = candidates[0].species, candidates[0].namplas, candidates[0].ships
+	}
+
+	return layout, nil
+}
+
+// speciesCountsOffset is the offset of NumNamplas in species_data. NumShips follows it.
+// The offset is the same in every layout since the padding is at the end of the record.
+const speciesCountsOffset = 156
+
+// fileHeader is the size of a data file and the bytes at the start of it.
+type fileHeader struct {
+	size int64
+	data []byte
+}
+
+// readHeader returns the size of the named file and the first n bytes from it.
+func readHeader(fsys fs.FS, name string, n int) (*fileHeader, error) {
+	fp, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	fi, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h := &fileHeader{size: fi.Size(), data: make([]byte, n)}
+	if _, err := io.ReadFull(fp, h.data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, &DataError{File: name, Record: "header", Index: 0, Offset: 0, Err: err}
+	}
+	return h, nil
+}
+
+// recordSize returns the first candidate record size that accounts for the
+// size of a file that starts with a record count.
+func (h *fileHeader) recordSize(bo binary.ByteOrder, candidates []int) (int, bool) {
+	count := int64(int32(bo.Uint32(h.data)))
+	if count < 0 {
+		return 0, false
+	}
+	for _, size := range candidates {
+		if 4+count*int64(size) == h.size {
+			return size, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,226 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeLayoutFiles writes a turn with two stars, three planets and two
+// species, each with two namplas and, if ships is set, three ships.
+func writeLayoutFiles(t *testing.T, dir string, layout *Layout, radius int32, ships bool) {
+	t.Helper()
+	galaxy := &galaxy_data{DNumSpecies: 2, NumSpecies: 2, Radius: radius, TurnNumber: 3}
+	if err := writeGalaxy(filepath.Join(dir, "galaxy.dat"), layout.ByteOrder, galaxy); err != nil {
+		t.Fatal(err)
+	}
+	stars := []star_data{{NumPlanets: 2}, {X: 1, NumPlanets: 1, PlanetIndex: 2}}
+	if err := writeStars(filepath.Join(dir, "stars.dat"), layout, stars); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePlanets(filepath.Join(dir, "planets.dat"), layout, make([]planet_data, 3)); err != nil {
+		t.Fatal(err)
+	}
+	for spNo := 1; spNo <= 2; spNo++ {
+		sp := &species_file{data: &species_data{}, namplas: make([]nampla_data, 2)}
+		if ships {
+			sp.ships = make([]ship_data, 3)
+		}
+		if err := writeSpecies(filepath.Join(dir, fmt.Sprintf("sp%02d.dat", spNo)), layout, sp); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// patchInt32 overwrites the int32 at offset in the named file.
+func patchInt32(t *testing.T, name string, bo binary.ByteOrder, offset int, v int32) {
+	t.Helper()
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bo.PutUint32(b[offset:], uint32(v))
+	if err := ioutil.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetectLayoutFS(t *testing.T) {
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		// layouts returns the layout of the Go structs with some sizes changed
+		layout := func(stars, ships int) *Layout {
+			l := NewLayout(bo)
+			l.StarSize, l.ShipSize = stars, ships
+			return l
+		}
+		goSize := NewLayout(bo)
+		for _, tc := range []struct {
+			name    string
+			written *Layout // the layout of the files
+			radius  int32
+			noShips bool
+			corrupt func(t *testing.T, dir string)
+			want    *Layout // nil for ErrUnknownLayout
+		}{
+			{name: "go sizes", written: goSize, radius: 15, want: goSize},
+			{name: "no padding", written: layout(goSize.StarSize-2, goSize.ShipSize-2), radius: 15, want: layout(goSize.StarSize-2, goSize.ShipSize-2)},
+			{name: "rounded up", written: layout(goSize.StarSize+4, goSize.ShipSize+4), radius: 15, want: layout(goSize.StarSize+4, goSize.ShipSize+4)},
+			// with no ships any ship size fits, so the first candidate wins
+			{name: "no ships", written: layout(goSize.StarSize, goSize.ShipSize+4), radius: 15, noShips: true, want: goSize},
+			{name: "zero radius", written: goSize, radius: 0},
+			{name: "large radius", written: goSize, radius: 128},
+			{name: "negative star count", written: goSize, radius: 15, corrupt: func(t *testing.T, dir string) {
+				patchInt32(t, filepath.Join(dir, "stars.dat"), bo, 0, -1)
+			}},
+			{name: "star count mismatch", written: goSize, radius: 15, corrupt: func(t *testing.T, dir string) {
+				patchInt32(t, filepath.Join(dir, "stars.dat"), bo, 0, 3)
+			}},
+			{name: "planets size mismatch", written: goSize, radius: 15, corrupt: func(t *testing.T, dir string) {
+				name := filepath.Join(dir, "planets.dat")
+				b, _ := ioutil.ReadFile(name)
+				if err := ioutil.WriteFile(name, append(b, 0), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}},
+			{name: "negative nampla count", written: goSize, radius: 15, corrupt: func(t *testing.T, dir string) {
+				patchInt32(t, filepath.Join(dir, "sp02.dat"), bo, speciesCountsOffset, -2)
+			}},
+			{name: "species size mismatch", written: goSize, radius: 15, corrupt: func(t *testing.T, dir string) {
+				patchInt32(t, filepath.Join(dir, "sp01.dat"), bo, speciesCountsOffset+4, 4)
+			}},
+			// sp01 has ships of one size and sp02 of another, so no combination fits both
+			{name: "species disagree", written: goSize, radius: 15, corrupt: func(t *testing.T, dir string) {
+				sp := &species_file{data: &species_data{}, namplas: make([]nampla_data, 2), ships: make([]ship_data, 3)}
+				if err := writeSpecies(filepath.Join(dir, "sp02.dat"), layout(goSize.StarSize, goSize.ShipSize+4), sp); err != nil {
+					t.Fatal(err)
+				}
+			}},
+		} {
+			t.Run(fmt.Sprintf("%s/%s", bo, tc.name), func(t *testing.T) {
+				dir := t.TempDir()
+				writeLayoutFiles(t, dir, tc.written, tc.radius, !tc.noShips)
+				if tc.corrupt != nil {
+					tc.corrupt(t, dir)
+				}
+				got, err := DetectLayoutFS(os.DirFS(dir))
+				if tc.want == nil {
+					if !errors.Is(err, ErrUnknownLayout) {
+						t.Fatalf("want ErrUnknownLayout: got %v, %v", got, err)
+					}
+					return
+				} else if err != nil {
+					t.Fatalf("want nil: got %v", err)
+				}
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("want %v: got %v", tc.want, got)
+				}
+			})
+		}
+	}
+}
+
+func TestDetectLayoutFSShortHeader(t *testing.T) {
+	dir := t.TempDir()
+	writeLayoutFiles(t, dir, NewLayout(binary.LittleEndian), 15, true)
+	if err := ioutil.WriteFile(filepath.Join(dir, "galaxy.dat"), []byte{1, 2, 3}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := DetectLayoutFS(os.DirFS(dir))
+	var de *DataError
+	if !errors.As(err, &de) || de.File != "galaxy.dat" || de.Record != "header" {
+		t.Fatalf("want galaxy.dat header *DataError: got %v", err)
+	} else if errors.Is(err, ErrUnknownLayout) {
+		t.Errorf("want a short file, not an unknown layout: got %v", err)
+	}
+}
+
+func TestLayoutSizes(t *testing.T) {
+	for _, tc := range []struct {
+		size, padding int
+		want          []int
+	}{
+		{52, 2, []int{52, 50, 56}},
+		{172, 2, []int{172, 170, 176}},
+		{40, 0, []int{40}},
+		{288, 0, []int{288}},
+		{20, 0, []int{20, 24}},
+	} {
+		if got := layoutSizes(tc.size, tc.padding); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%d, %d: want %v: got %v", tc.size, tc.padding, tc.want, got)
+		}
+	}
+}
+
+func TestFileHeaderRecordSize(t *testing.T) {
+	for _, tc := range []struct {
+		count int32
+		size  int64
+		want  int
+		ok    bool
+	}{
+		{count: 2, size: 4 + 2*52, want: 52, ok: true},
+		{count: 2, size: 4 + 2*50, want: 50, ok: true},
+		{count: 2, size: 4 + 2*56, want: 56, ok: true},
+		{count: 0, size: 4, want: 52, ok: true},
+		{count: 2, size: 4 + 2*52 + 1},
+		{count: 3, size: 4 + 2*52},
+		{count: -1, size: 4 - 52},
+	} {
+		for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			h := &fileHeader{size: tc.size, data: make([]byte, 4)}
+			bo.PutUint32(h.data, uint32(tc.count))
+			got, ok := h.recordSize(bo, []int{52, 50, 56})
+			if got != tc.want || ok != tc.ok {
+				t.Errorf("%s: %d in %d bytes: want %d %v: got %d %v", bo, tc.count, tc.size, tc.want, tc.ok, got, ok)
+			}
+		}
+	}
+}
+
+// TestSpeciesCountsOffset checks the offset that detection reads the counts
+// from against the encoded species_data, so that a change to the fields
+// before them can't silently break detection.
+func TestSpeciesCountsOffset(t *testing.T) {
+	for _, bo := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var b bytes.Buffer
+		if err := binary.Write(&b, bo, &species_data{NumNamplas: 0x01020304, NumShips: 0x05060708}); err != nil {
+			t.Fatal(err)
+		}
+		data := b.Bytes()
+		if got := bo.Uint32(data[speciesCountsOffset:]); got != 0x01020304 {
+			t.Errorf("%s: NumNamplas: want %#x: got %#x", bo, 0x01020304, got)
+		}
+		if got := bo.Uint32(data[speciesCountsOffset+4:]); got != 0x05060708 {
+			t.Errorf("%s: NumShips: want %#x: got %#x", bo, 0x05060708, got)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+// FleetMaintenance is the fleet maintenance for a species recalculated from its ships
+// and reconciled with the maintenance cost and percentage stored in the species data.
+type FleetMaintenance struct {
+	Species          *Species
+	Ships            []*ShipMaintenance
+	GrossCost        int // total maintenance before the military discount
+	MilitaryDiscount int // discount for the species' military tech level
+	Cost             int // expected fleet maintenance cost
+	Pct              int // expected cost as a percentage, times one hundred, of production
+	StoredCost       int
+	StoredPct        int
+	CostMismatch     bool // true if the expected cost does not match the stored cost
+	PctMismatch      bool // true if the expected percentage does not match the stored percentage
+}
+
+// ShipMaintenance is the maintenance for a single ship, before the military discount.
+type ShipMaintenance struct {
+	Ship         *Ship
+	Pct          int  // maintenance as a percentage of the ship's cost
+	Cost         int  // maintenance cost
+	SubLight     bool // true if the sub-light discount was applied
+	Unmaintained bool // true if the ship is under construction or unused and needs no maintenance
+}
+
+// ReconcileFleetMaintenance recalculates the fleet maintenance for the species the way
+// the engine does. Each ship's maintenance is a percentage of its cost based on its class
+// and tonnage, with the sub-light discount. Ships under construction need no maintenance,
+// and neither do unused ship records, which the engine skips.
+// The total is then discounted by half of the species' military tech level.
+// Because the discount is taken from the total, the sum of the MaintenanceCost of the
+// ships may differ slightly from the fleet cost.
+func ReconcileFleetMaintenance(species *Species) *FleetMaintenance {
+	fm := &FleetMaintenance{
+		Species:    species,
+		StoredCost: species.FleetMaintenanceCost,
+		StoredPct:  species.FleetMaintenancePct,
+	}
+	for _, ship := range species.Ships {
+		code := shipClassToCode(ship.Class)
+		sm := &ShipMaintenance{
+			Ship:         ship,
+			Pct:          codeToShipMaintenancePct(code),
+			SubLight:     ship.Type == SUB_LIGHT, // starbases don't get the sub-light discount
+			Unmaintained: ship.UnderConstruction || ship.Orbit == UNUSED_SHIP_ORBIT,
+		}
+		fm.Ships = append(fm.Ships, sm)
+		if sm.Unmaintained {
+			continue
+		}
+		sm.Cost = (sm.Pct * codeToShipCost(code, ship.Tonnage/10_000)) / 100
+		if sm.SubLight {
+			sm.Cost -= (25 * sm.Cost) / 100
+		}
+		fm.GrossCost += sm.Cost
+	}
+	fm.MilitaryDiscount = (species.ML.CurrentLevel / 2 * fm.GrossCost) / 100
+	fm.Cost = fm.GrossCost - fm.MilitaryDiscount
+	if species.EconUnitsProduced > 0 {
+		fm.Pct = (10000 * fm.Cost) / species.EconUnitsProduced
+	} else {
+		fm.Pct = 10000
+	}
+	fm.CostMismatch = fm.Cost != fm.StoredCost
+	fm.PctMismatch = fm.Pct != fm.StoredPct
+	return fm
+}
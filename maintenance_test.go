@@ -0,0 +1,96 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import "testing"
+
+// newMaintenanceTestSpecies returns a species with ML 9, which is a 4% discount
+// since half of the level is rounded down, and a ship of each maintenance rule.
+func newMaintenanceTestSpecies(storedCost, storedPct, produced int) *Species {
+	species := &Species{Name: "Alpha", FleetMaintenanceCost: storedCost, FleetMaintenancePct: storedPct, EconUnitsProduced: produced}
+	species.ML.CurrentLevel = 9
+	species.Ships = []*Ship{
+		{Name: "PB", Class: "PB", Tonnage: 10_000},                                                              // 20% of 100 is 20
+		{Name: "DD", Class: "DD", Tonnage: 150_000},                                                             // 20% of 1,500 is 300
+		{Name: "TRS", Class: "TR", Tonnage: 200_000, SubLight: true, Type: SUB_LIGHT},                           // 4% of 2,000 is 80, less 25% is 60
+		{Name: "TR", Class: "TR", Tonnage: 30_000},                                                              // 4% of 300 is 12
+		{Name: "BA", Class: "BA", Tonnage: 50_000, SubLight: true, Type: STARBASE},                              // 10% of 500 is 50, not discounted
+		{Name: "BA new", Class: "BA", Tonnage: 50_000, SubLight: true, Type: STARBASE, UnderConstruction: true}, // not maintained
+		{Name: "Unused", Class: "DD", Tonnage: 150_000, Orbit: UNUSED_SHIP_ORBIT, InDeepSpace: true},            // not maintained
+	}
+	return species
+}
+
+func TestReconcileFleetMaintenance(t *testing.T) {
+	// the gross cost is 442 and 4% of that is 17, so the cost is 425, which is 42.50% of 1,000 EUs
+	for _, tc := range []struct {
+		name                      string
+		storedCost, storedPct     int
+		produced                  int
+		pct                       int
+		costMismatch, pctMismatch bool
+	}{
+		{name: "matches", storedCost: 425, storedPct: 4250, produced: 1000, pct: 4250},
+		{name: "cost differs", storedCost: 430, storedPct: 4250, produced: 1000, pct: 4250, costMismatch: true},
+		{name: "percent differs", storedCost: 425, storedPct: 4300, produced: 1000, pct: 4250, pctMismatch: true},
+		{name: "both differ", storedCost: 443, storedPct: 4430, produced: 1000, pct: 4250, costMismatch: true, pctMismatch: true},
+		{name: "no production", storedCost: 425, storedPct: 10000, produced: 0, pct: 10000},
+	} {
+		fm := ReconcileFleetMaintenance(newMaintenanceTestSpecies(tc.storedCost, tc.storedPct, tc.produced))
+		if fm.GrossCost != 442 || fm.MilitaryDiscount != 17 || fm.Cost != 425 || fm.Pct != tc.pct {
+			t.Errorf("%s: want 442 - 17 = 425 at %d: got %d - %d = %d at %d", tc.name, tc.pct, fm.GrossCost, fm.MilitaryDiscount, fm.Cost, fm.Pct)
+		}
+		if fm.StoredCost != tc.storedCost || fm.StoredPct != tc.storedPct {
+			t.Errorf("%s: stored: want %d %d: got %d %d", tc.name, tc.storedCost, tc.storedPct, fm.StoredCost, fm.StoredPct)
+		}
+		if fm.CostMismatch != tc.costMismatch || fm.PctMismatch != tc.pctMismatch {
+			t.Errorf("%s: mismatch: want %v %v: got %v %v", tc.name, tc.costMismatch, tc.pctMismatch, fm.CostMismatch, fm.PctMismatch)
+		}
+	}
+}
+
+func TestReconcileFleetMaintenanceShips(t *testing.T) {
+	fm := ReconcileFleetMaintenance(newMaintenanceTestSpecies(0, 0, 0))
+	for i, want := range []struct {
+		pct, cost              int
+		subLight, unmaintained bool
+	}{
+		{20, 20, false, false},
+		{20, 300, false, false},
+		{4, 60, true, false},
+		{4, 12, false, false},
+		{10, 50, false, false},
+		{10, 0, false, true},
+		{20, 0, false, true},
+	} {
+		sm := fm.Ships[i]
+		if sm.Pct != want.pct || sm.Cost != want.cost || sm.SubLight != want.subLight || sm.Unmaintained != want.unmaintained {
+			t.Errorf("%s: want %d%% %d %v %v: got %d%% %d %v %v", sm.Ship.Name,
+				want.pct, want.cost, want.subLight, want.unmaintained, sm.Pct, sm.Cost, sm.SubLight, sm.Unmaintained)
+		}
+	}
+	if !fm.CostMismatch {
+		t.Errorf("want a cost mismatch against a stored cost of 0")
+	}
+}
@@ -0,0 +1,79 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+// colonyProduction returns the number of economic units the colony produces each turn.
+// It follows the engine: the raw material units come from the mining base and MI tech,
+// the production capacity comes from the manufacturing base and MA tech, and both are
+// reduced by the life support penalty and the planet's economic efficiency.
+// Mining colonies produce two-thirds of their raw material units, resort colonies
+// produce two-thirds of their production capacity, and other colonies produce the
+// lesser of the two. A colony under siege loses its siege effectiveness percentage.
+func colonyProduction(species *Species, colony *Colony) int {
+	if colony.Planet == nil || colony.Is.DisbandedColony {
+		return 0
+	}
+	planet := colony.Planet
+
+	// the mining base is stored times 10 and the mining difficulty times 100
+	rawMaterialUnits := 0
+	if planet.MiningDifficultyBase > 0 {
+		rawMaterialUnits = (10 * species.MI.CurrentLevel * colony.MiningBase) / planet.MiningDifficultyBase
+	}
+	// the manufacturing base is stored times 10
+	productionCapacity := (species.MA.CurrentLevel * colony.ManufacturingBase) / 10
+
+	// each point of life support needed reduces production
+	productionPenalty := 0
+	if colony.LSN != 0 {
+		if species.LS.CurrentLevel > 0 {
+			productionPenalty = (100 * colony.LSN) / species.LS.CurrentLevel
+		}
+		if species.LS.CurrentLevel <= 0 || productionPenalty > 100 {
+			productionPenalty = 100
+		}
+	}
+	rawMaterialUnits -= (productionPenalty * rawMaterialUnits) / 100
+	rawMaterialUnits = ((planet.EconEfficiency * rawMaterialUnits) + 50) / 100
+	productionCapacity -= (productionPenalty * productionCapacity) / 100
+	productionCapacity = ((planet.EconEfficiency * productionCapacity) + 50) / 100
+
+	var production int
+	if colony.Is.MiningColony {
+		production = (2 * rawMaterialUnits) / 3
+	} else if colony.Is.ResortColony {
+		production = (2 * productionCapacity) / 3
+	} else if productionCapacity > rawMaterialUnits {
+		production = rawMaterialUnits
+	} else {
+		production = productionCapacity
+	}
+
+	// a siege reduces production by the siege effectiveness
+	if colony.SiegeEffPct > 0 {
+		production -= (colony.SiegeEffPct * production) / 100
+	}
+
+	return production
+}
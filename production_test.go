@@ -0,0 +1,86 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import "testing"
+
+func TestColonyProduction(t *testing.T) {
+	species := &Species{}
+	species.MI.CurrentLevel, species.MA.CurrentLevel, species.LS.CurrentLevel = 10, 12, 5
+	noLS := &Species{}
+	noLS.MI.CurrentLevel, noLS.MA.CurrentLevel = 10, 12
+
+	planet := func(md, eff int) *Planet {
+		return &Planet{MiningDifficultyBase: md, EconEfficiency: eff}
+	}
+	home := func() *Colony {
+		c := &Colony{Planet: planet(150, 100), MiningBase: 300, ManufacturingBase: 400}
+		c.Is.HomePlanet = true
+		return c
+	}
+	mining := func() *Colony {
+		c := &Colony{Planet: planet(150, 80), MiningBase: 600, LSN: 2}
+		c.Is.MiningColony = true
+		return c
+	}
+	for _, tc := range []struct {
+		name    string
+		species *Species
+		colony  func() *Colony
+		want    int
+	}{
+		// raw materials 10*10*300/150 = 200, capacity 12*400/10 = 480, the lesser is produced
+		{"home", species, home, 200},
+		// both are 80% of 200 and 480, rounded
+		{"home efficiency", species, func() *Colony { c := home(); c.Planet.EconEfficiency = 80; return c }, 160},
+		// capacity 12*100/10 = 120 is less than raw materials
+		{"capacity limited", species, func() *Colony { c := home(); c.ManufacturingBase = 100; return c }, 120},
+		// 25% of 200 is lost to the siege
+		{"home under siege", species, func() *Colony { c := home(); c.SiegeEffPct = 25; return c }, 150},
+		// raw materials 10*10*600/150 = 400, less the 100*2/5 = 40% penalty is 240,
+		// at 80% efficiency is 192, and two-thirds of that is 128
+		{"mining", species, mining, 128},
+		{"mining under siege", species, func() *Colony { c := mining(); c.SiegeEffPct = 25; return c }, 96},
+		// capacity 12*150/10 = 180, less the 20% penalty is 144, at 60% efficiency
+		// is 86, and two-thirds of that is 57
+		{"resort", species, func() *Colony {
+			c := &Colony{Planet: planet(150, 60), ManufacturingBase: 150, LSN: 1}
+			c.Is.ResortColony = true
+			return c
+		}, 57},
+		// a penalty of 100*7/5 = 140% is clamped at 100%
+		{"penalty clamped", species, func() *Colony { c := mining(); c.LSN = 7; return c }, 0},
+		{"penalty at 100", species, func() *Colony { c := mining(); c.LSN = 5; return c }, 0},
+		// with no life support tech any life support needed is a 100% penalty
+		{"no LS tech", noLS, func() *Colony { c := home(); c.LSN = 1; return c }, 0},
+		{"no LS tech or LSN", noLS, home, 200},
+		{"no mining difficulty", species, func() *Colony { c := home(); c.Planet.MiningDifficultyBase = 0; return c }, 0},
+		{"disbanded", species, func() *Colony { c := home(); c.Is.DisbandedColony = true; return c }, 0},
+		{"no planet", species, func() *Colony { c := home(); c.Planet = nil; return c }, 0},
+	} {
+		if got := colonyProduction(tc.species, tc.colony()); got != tc.want {
+			t.Errorf("%s: want %d: got %d", tc.name, tc.want, got)
+		}
+	}
+}
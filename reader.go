@@ -26,30 +26,134 @@ package fhdata
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 )
 
+var (
+	// ErrBadCount is returned when a record count in a data file is negative or needs more data than the file holds.
+	ErrBadCount = errors.New("bad record count")
+	// ErrTrailingData is returned when a data file has data after the last record.
+	ErrTrailingData = errors.New("trailing data after last record")
+)
+
+// DataError reports a corrupt or truncated data file.
+type DataError struct {
+	File   string // name of the data file
+	Record string // kind of record being read, e.g. "star_data"
+	Index  int    // index (starting at zero) of the record
+	Offset int64  // byte offset of the record in the file
+	Err    error
+}
+
+func (e *DataError) Error() string {
+	return fmt.Sprintf("%s: %s %d at offset %d: %v", e.File, e.Record, e.Index, e.Offset, e.Err)
+}
+
+func (e *DataError) Unwrap() error {
+	return e.Err
+}
+
+// recordReader reads fixed size records from a data file, tracking the byte offset for error reporting.
+type recordReader struct {
+	name string
+	bo   binary.ByteOrder
+	r    *bytes.Reader
+	size int64
+}
+
+func newRecordReader(name string, b []byte, bo binary.ByteOrder) *recordReader {
+	return &recordReader{name: name, bo: bo, r: bytes.NewReader(b), size: int64(len(b))}
+}
+
+// checkCount returns an error if count records of the given kind and size can't fit in the remaining data.
+// It should be called before allocating space for the records.
+func (rr *recordReader) checkCount(kind string, count int, size int) error {
+	if count < 0 {
+		return &DataError{File: rr.name, Record: kind, Index: 0, Offset: rr.offset(), Err: fmt.Errorf("%w: %d", ErrBadCount, count)}
+	}
+	if need := int64(count) * int64(size); need > int64(rr.r.Len()) {
+		return &DataError{File: rr.name, Record: kind, Index: 0, Offset: rr.offset(), Err: fmt.Errorf("%w: %d records need %d bytes, only %d remain", ErrBadCount, count, need, rr.r.Len())}
+	}
+	return nil
+}
+
+// checkEOF returns an error if there is any data left after the last record.
+func (rr *recordReader) checkEOF(kind string, index int) error {
+	if rr.r.Len() != 0 {
+		return &DataError{File: rr.name, Record: kind, Index: index, Offset: rr.offset(), Err: fmt.Errorf("%w: %d bytes", ErrTrailingData, rr.r.Len())}
+	}
+	return nil
+}
+
+func (rr *recordReader) offset() int64 {
+	return rr.size - int64(rr.r.Len())
+}
+
+// read reads the next record into data.
+func (rr *recordReader) read(kind string, index int, data interface{}) error {
+	return rr.readRecord(kind, index, binary.Size(data), data)
+}
+
+// readRecord reads the next record, which is size bytes long in the file, into data.
+// The record is truncated or zero-filled to the size of data.
+func (rr *recordReader) readRecord(kind string, index int, size int, data interface{}) error {
+	offset := rr.offset()
+	buf := make([]byte, size, size)
+	if _, err := io.ReadFull(rr.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return &DataError{File: rr.name, Record: kind, Index: index, Offset: offset, Err: err}
+	}
+	if n := binary.Size(data); n > size {
+		buf = append(buf, make([]byte, n-size)...)
+	}
+	if err := binary.Read(bytes.NewReader(buf), rr.bo, data); err != nil {
+		return &DataError{File: rr.name, Record: kind, Index: index, Offset: offset, Err: err}
+	}
+	return nil
+}
+
 // readGalaxy returns either an initialized galaxy_data or an error.
-func readGalaxy(name string, bo binary.ByteOrder) (*galaxy_data, error) {
-	b, err := ioutil.ReadFile(name)
+func readGalaxy(fsys fs.FS, name string, bo binary.ByteOrder) (*galaxy_data, error) {
+	fp, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return readGalaxyFrom(fp, name, bo)
+}
+
+// readGalaxyFrom reads galaxy_data from r. The name is used only to report errors.
+func readGalaxyFrom(r io.Reader, name string, bo binary.ByteOrder) (*galaxy_data, error) {
+	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	r := bytes.NewReader(b)
+	rr := newRecordReader(name, b, bo)
 
 	g := &galaxy_data{}
-	if err := binary.Read(r, bo, g); err != nil {
+	if err := rr.read("galaxy_data", 0, g); err != nil {
+		return nil, err
+	}
+	if err := rr.checkEOF("galaxy_data", 1); err != nil {
 		return nil, err
 	}
 
 	return g, nil
 }
 
-func readNamplas(r io.Reader, num_namplas int, bo binary.ByteOrder) ([]nampla_data, error) {
+func readNamplas(rr *recordReader, num_namplas int, size int) ([]nampla_data, error) {
+	if err := rr.checkCount("nampla_data", num_namplas, size); err != nil {
+		return nil, err
+	}
 	namplas := make([]nampla_data, num_namplas)
 	for i := 0; i < num_namplas; i++ {
-		if err := binary.Read(r, bo, &namplas[i]); err != nil {
+		if err := rr.readRecord("nampla_data", i, size, &namplas[i]); err != nil {
 			return nil, err
 		}
 	}
@@ -57,33 +161,52 @@ func readNamplas(r io.Reader, num_namplas int, bo binary.ByteOrder) ([]nampla_da
 }
 
 // readPlanets returns either an initialized set of planets or an error
-func readPlanets(name string, bo binary.ByteOrder) ([]planet_data, error) {
-	b, err := ioutil.ReadFile(name)
+func readPlanets(fsys fs.FS, name string, layout *Layout) ([]planet_data, error) {
+	fp, err := fsys.Open(name)
 	if err != nil {
 		return nil, err
 	}
-	r := bytes.NewReader(b)
+	defer fp.Close()
+	return readPlanetsFrom(fp, name, layout)
+}
+
+// readPlanetsFrom reads planet data from r. The name is used only to report errors.
+func readPlanetsFrom(r io.Reader, name string, layout *Layout) ([]planet_data, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	rr := newRecordReader(name, b, layout.ByteOrder)
 
 	var pd planet_file
-	if err := binary.Read(r, bo, &pd.NumPlanets); err != nil {
+	if err := rr.read("num_planets", 0, &pd.NumPlanets); err != nil {
 		return nil, err
 	}
 
 	num_planets := int(pd.NumPlanets)
+	if err := rr.checkCount("planet_data", num_planets, layout.PlanetSize); err != nil {
+		return nil, err
+	}
 	planet_base := make([]planet_data, num_planets, num_planets)
 	for i := 0; i < num_planets; i++ {
-		if err := binary.Read(r, bo, &planet_base[i]); err != nil {
+		if err := rr.readRecord("planet_data", i, layout.PlanetSize, &planet_base[i]); err != nil {
 			return nil, err
 		}
 	}
+	if err := rr.checkEOF("planet_data", num_planets); err != nil {
+		return nil, err
+	}
 
 	return planet_base, nil
 }
 
-func readShips(r io.Reader, num_ships int, bo binary.ByteOrder) ([]ship_data, error) {
+func readShips(rr *recordReader, num_ships int, size int) ([]ship_data, error) {
+	if err := rr.checkCount("ship_data", num_ships, size); err != nil {
+		return nil, err
+	}
 	ships := make([]ship_data, num_ships)
 	for i := 0; i < num_ships; i++ {
-		if err := binary.Read(r, bo, &ships[i]); err != nil {
+		if err := rr.readRecord("ship_data", i, size, &ships[i]); err != nil {
 			return nil, err
 		}
 	}
@@ -91,53 +214,83 @@ func readShips(r io.Reader, num_ships int, bo binary.ByteOrder) ([]ship_data, er
 }
 
 // readSpecies returns either an initialized species with namplas and ships or an error.
-func readSpecies(name string, bo binary.ByteOrder) (*species_file, error) {
-	b, err := ioutil.ReadFile(name)
+func readSpecies(fsys fs.FS, name string, layout *Layout) (*species_file, error) {
+	fp, err := fsys.Open(name)
 	if err != nil {
 		return nil, err
 	}
-	r := bytes.NewReader(b)
+	defer fp.Close()
+	return readSpeciesFrom(fp, name, layout)
+}
+
+// readSpeciesFrom reads species data from r. The name is used only to report errors.
+func readSpeciesFrom(r io.Reader, name string, layout *Layout) (*species_file, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	rr := newRecordReader(name, b, layout.ByteOrder)
 
 	sp := &species_file{
 		data: &species_data{},
 	}
-	if err := binary.Read(r, bo, sp.data); err != nil {
+	if err := rr.readRecord("species_data", 0, layout.SpeciesSize, sp.data); err != nil {
 		return nil, err
 	}
 
-	sp.namplas, err = readNamplas(r, int(sp.data.NumNamplas), bo)
+	sp.namplas, err = readNamplas(rr, int(sp.data.NumNamplas), layout.NamplaSize)
 	if err != nil {
 		return nil, err
 	}
 
-	sp.ships, err = readShips(r, int(sp.data.NumShips), bo)
+	sp.ships, err = readShips(rr, int(sp.data.NumShips), layout.ShipSize)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := rr.checkEOF("ship_data", len(sp.ships)); err != nil {
+		return nil, err
+	}
+
 	return sp, nil
 }
 
 // readStars returns either an initialized set of star_data or an error.
-func readStars(name string, bo binary.ByteOrder) ([]star_data, error) {
-	b, err := ioutil.ReadFile(name)
+func readStars(fsys fs.FS, name string, layout *Layout) ([]star_data, error) {
+	fp, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return readStarsFrom(fp, name, layout)
+}
+
+// readStarsFrom reads star_data from r. The name is used only to report errors.
+func readStarsFrom(r io.Reader, name string, layout *Layout) ([]star_data, error) {
+	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	r := bytes.NewReader(b)
+	rr := newRecordReader(name, b, layout.ByteOrder)
 
 	var sd star_file
-	if err := binary.Read(r, bo, &sd.NumStars); err != nil {
+	if err := rr.read("num_stars", 0, &sd.NumStars); err != nil {
 		return nil, err
 	}
 
 	num_stars := int(sd.NumStars)
+	if err := rr.checkCount("star_data", num_stars, layout.StarSize); err != nil {
+		return nil, err
+	}
 	star_base := make([]star_data, num_stars, num_stars)
 	for i := 0; i < num_stars; i++ {
-		if err := binary.Read(r, bo, &star_base[i]); err != nil {
+		if err := rr.readRecord("star_data", i, layout.StarSize, &star_base[i]); err != nil {
 			return nil, err
 		}
 	}
+	if err := rr.checkEOF("star_data", num_stars); err != nil {
+		return nil, err
+	}
 
 	return star_base, nil
 }
@@ -0,0 +1,209 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// truncateFile cuts n bytes from the end of the named file, or appends
+// zero bytes if n is negative.
+func truncateFile(t *testing.T, name string, n int) {
+	t.Helper()
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 0 {
+		b = append(b, make([]byte, -n)...)
+	} else {
+		b = b[:len(b)-n]
+	}
+	if err := ioutil.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFromFSDataErrors(t *testing.T) {
+	layout := NewLayout(binary.LittleEndian)
+	bo := layout.ByteOrder
+	// the files from writeLayoutFiles: two stars, three planets, and species with two namplas and three ships
+	shipsOffset := int64(layout.SpeciesSize + 2*layout.NamplaSize)
+	for _, tc := range []struct {
+		name    string
+		corrupt func(t *testing.T, dir string)
+		file    string
+		record  string
+		index   int
+		offset  int64
+		err     error
+	}{
+		{
+			name:    "truncated stars",
+			corrupt: func(t *testing.T, dir string) { truncateFile(t, filepath.Join(dir, "stars.dat"), 10) },
+			file:    "stars.dat", record: "star_data", index: 0, offset: 4, err: ErrBadCount,
+		},
+		{
+			name:    "star count past end",
+			corrupt: func(t *testing.T, dir string) { patchInt32(t, filepath.Join(dir, "stars.dat"), bo, 0, 5) },
+			file:    "stars.dat", record: "star_data", index: 0, offset: 4, err: ErrBadCount,
+		},
+		{
+			name:    "negative planet count",
+			corrupt: func(t *testing.T, dir string) { patchInt32(t, filepath.Join(dir, "planets.dat"), bo, 0, -1) },
+			file:    "planets.dat", record: "planet_data", index: 0, offset: 4, err: ErrBadCount,
+		},
+		{
+			name:    "trailing planets",
+			corrupt: func(t *testing.T, dir string) { truncateFile(t, filepath.Join(dir, "planets.dat"), -3) },
+			file:    "planets.dat", record: "planet_data", index: 3, offset: int64(4 + 3*layout.PlanetSize), err: ErrTrailingData,
+		},
+		{
+			name:    "trailing stars",
+			corrupt: func(t *testing.T, dir string) { truncateFile(t, filepath.Join(dir, "stars.dat"), -1) },
+			file:    "stars.dat", record: "star_data", index: 2, offset: int64(4 + 2*layout.StarSize), err: ErrTrailingData,
+		},
+		{
+			name:    "truncated galaxy",
+			corrupt: func(t *testing.T, dir string) { truncateFile(t, filepath.Join(dir, "galaxy.dat"), 1) },
+			file:    "galaxy.dat", record: "galaxy_data", index: 0, offset: 0, err: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "trailing galaxy",
+			corrupt: func(t *testing.T, dir string) { truncateFile(t, filepath.Join(dir, "galaxy.dat"), -4) },
+			file:    "galaxy.dat", record: "galaxy_data", index: 1, offset: 16, err: ErrTrailingData,
+		},
+		{
+			name:    "negative species count",
+			corrupt: func(t *testing.T, dir string) { patchInt32(t, filepath.Join(dir, "galaxy.dat"), bo, 4, -1) },
+			file:    "galaxy.dat", record: "galaxy_data", index: 0, offset: 4, err: ErrBadCount,
+		},
+		{
+			name: "short species",
+			corrupt: func(t *testing.T, dir string) {
+				truncateFile(t, filepath.Join(dir, "sp01.dat"), int(shipsOffset)+3*layout.ShipSize-100)
+			},
+			file: "sp01.dat", record: "species_data", index: 0, offset: 0, err: io.ErrUnexpectedEOF,
+		},
+		{
+			name: "nampla count past end",
+			corrupt: func(t *testing.T, dir string) {
+				patchInt32(t, filepath.Join(dir, "sp02.dat"), bo, speciesCountsOffset, 50)
+			},
+			file: "sp02.dat", record: "nampla_data", index: 0, offset: int64(layout.SpeciesSize), err: ErrBadCount,
+		},
+		{
+			name: "negative ship count",
+			corrupt: func(t *testing.T, dir string) {
+				patchInt32(t, filepath.Join(dir, "sp01.dat"), bo, speciesCountsOffset+4, -3)
+			},
+			file: "sp01.dat", record: "ship_data", index: 0, offset: shipsOffset, err: ErrBadCount,
+		},
+		{
+			name:    "truncated ships",
+			corrupt: func(t *testing.T, dir string) { truncateFile(t, filepath.Join(dir, "sp02.dat"), 1) },
+			file:    "sp02.dat", record: "ship_data", index: 0, offset: shipsOffset, err: ErrBadCount,
+		},
+		{
+			name:    "trailing species",
+			corrupt: func(t *testing.T, dir string) { truncateFile(t, filepath.Join(dir, "sp01.dat"), -2) },
+			file:    "sp01.dat", record: "ship_data", index: 3, offset: shipsOffset + int64(3*layout.ShipSize), err: ErrTrailingData,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeLayoutFiles(t, dir, layout, 15, true)
+			tc.corrupt(t, dir)
+
+			_, err := LoadFromFS(os.DirFS(dir), layout)
+			var de *DataError
+			if !errors.As(err, &de) {
+				t.Fatalf("want *DataError: got %v", err)
+			}
+			if de.File != tc.file || de.Record != tc.record || de.Index != tc.index || de.Offset != tc.offset {
+				t.Errorf("want %s %s %d at %d: got %s %s %d at %d", tc.file, tc.record, tc.index, tc.offset, de.File, de.Record, de.Index, de.Offset)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Errorf("want %v: got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestRecordReaderTruncatedRecord(t *testing.T) {
+	layout := NewLayout(binary.BigEndian)
+	// the count is checked before the records are read, so a short record
+	// is found only when the reader is given fewer bytes than it asks for.
+	b := make([]byte, 4+layout.StarSize+layout.StarSize/2)
+	rr := newRecordReader("stars.dat", b, layout.ByteOrder)
+	var count int32
+	if err := rr.read("num_stars", 0, &count); err != nil {
+		t.Fatal(err)
+	}
+	var star star_data
+	if err := rr.readRecord("star_data", 0, layout.StarSize, &star); err != nil {
+		t.Fatalf("want nil: got %v", err)
+	}
+	err := rr.readRecord("star_data", 1, layout.StarSize, &star)
+	var de *DataError
+	if !errors.As(err, &de) {
+		t.Fatalf("want *DataError: got %v", err)
+	}
+	if de.File != "stars.dat" || de.Record != "star_data" || de.Index != 1 || de.Offset != int64(4+layout.StarSize) {
+		t.Errorf("want stars.dat star_data 1 at %d: got %v", 4+layout.StarSize, err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("want io.ErrUnexpectedEOF: got %v", err)
+	}
+}
+
+func TestRecordReaderCheckCount(t *testing.T) {
+	rr := newRecordReader("planets.dat", make([]byte, 100), binary.LittleEndian)
+	for _, tc := range []struct {
+		count, size int
+		ok          bool
+	}{
+		{0, 40, true},
+		{2, 40, true},
+		{2, 50, true},
+		{3, 40, false},
+		{-1, 40, false},
+		{1 << 30, 40, false},
+	} {
+		err := rr.checkCount("planet_data", tc.count, tc.size)
+		if tc.ok {
+			if err != nil {
+				t.Errorf("%d of %d: want nil: got %v", tc.count, tc.size, err)
+			}
+		} else if !errors.Is(err, ErrBadCount) {
+			t.Errorf("%d of %d: want ErrBadCount: got %v", tc.count, tc.size, err)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoSuchTurn is returned when a turn is not in the store.
+	ErrNoSuchTurn = errors.New("no such turn")
+	// ErrNoSuchSpecies is returned when a species is not in a turn.
+	ErrNoSuchSpecies = errors.New("no such species")
+)
+
+// Store is a history of turns that are loaded on demand.
+// The most recently used turns are kept in memory along with
+// the fog-of-war views built from them.
+type Store struct {
+	root     string
+	capacity int     // maximum number of turns kept in memory
+	single   bool    // root is the data for a single turn
+	layout   *Layout // layout of the data files, nil to detect it for each turn
+
+	reloadMu sync.Mutex // serializes Reload
+
+	mu      sync.Mutex            // protects the fields below
+	sources map[int]source        // where each turn's data is, by turn number
+	indexed string                // fingerprint of the sources when last indexed
+	lru     *list.List            // loaded turns, most recently used first
+	loaded  map[int]*list.Element // loaded turns, by turn number
+	loading map[int]*storeLoad    // turns being read on demand, by turn number
+}
+
+// source is where the data for one turn is read from.
+type source struct {
+	path  string
+	stamp string // changes whenever the turn's data files change
+}
+
+type storeEntry struct {
+	turn    int
+	stamp   string // the stamp of the source when it was loaded
+	cluster *Cluster
+	layout  *Layout
+
+	mu    sync.Mutex         // protects views
+	views map[int]*storeView // by species id
+}
+
+// storeView is a species' view of a turn, built once on first use.
+type storeView struct {
+	once    sync.Once
+	cluster *Cluster
+}
+
+// storeLoad is a turn being read on demand. Requests for the turn
+// wait for done rather than reading it again.
+type storeLoad struct {
+	done  chan struct{}
+	entry *storeEntry
+	err   error
+}
+
+// turnNumber matches the last run of digits in an entry name,
+// so "turn-012", "t12.zip" and "2021/t12.tgz" are all turn 12.
+var turnNumber = regexp.MustCompile(`(\d+)[^\d]*$`)
+
+// OpenStore indexes the turns under root.
+// The root is either the data for a single turn (a directory holding
+// galaxy.dat or a turn archive) or a directory with one subdirectory
+// or archive per turn, named with the turn number.
+// At most capacity turns are kept in memory; it must be at least one.
+// The layout of each turn's data files is detected when it is read.
+func OpenStore(root string, capacity int) (*Store, error) {
+	return OpenStoreWithLayout(root, capacity, nil)
+}
+
+// OpenStoreWithLayout is OpenStore for data files with a known layout.
+// A nil layout means the layout is detected.
+func OpenStoreWithLayout(root string, capacity int, layout *Layout) (*Store, error) {
+	if capacity < 1 {
+		return nil, fmt.Errorf("store: capacity %d: must be at least 1", capacity)
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		root:     root,
+		capacity: capacity,
+		single:   !fi.IsDir() || fileExists(filepath.Join(root, "galaxy.dat")),
+		layout:   layout,
+		lru:      list.New(),
+		loaded:   make(map[int]*list.Element),
+		loading:  make(map[int]*storeLoad),
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload indexes the root again and reads the turns whose data files
+// have changed. The latest turn, and any changed turn that is in memory,
+// are read before the new index is swapped in, so if any of them fail
+// to load the store keeps serving the turns it had.
+// Clusters that were already returned are never modified.
+func (s *Store) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	sources, err := s.index()
+	if err != nil {
+		return err
+	}
+
+	// the slow reads happen without holding the lock
+	s.mu.Lock()
+	current := make(map[string]*storeEntry) // by source path
+	for _, turn := range s.loaded {
+		entry := turn.Value.(*storeEntry)
+		current[s.sources[entry.turn].path] = entry
+	}
+	s.mu.Unlock()
+
+	fresh := make(map[int]*storeEntry)
+	if s.single {
+		// only the data knows the turn number of a single turn
+		src := sources[0]
+		entry, ok := current[src.path]
+		if !ok || entry.stamp != src.stamp {
+			if entry, err = s.load(src); err != nil {
+				return err
+			}
+		}
+		sources = map[int]source{entry.turn: src}
+		fresh[entry.turn] = entry
+	} else {
+		latest := -1
+		for turn := range sources {
+			if turn > latest {
+				latest = turn
+			}
+		}
+		for turn, src := range sources {
+			entry, ok := current[src.path]
+			if ok && entry.turn == turn && entry.stamp == src.stamp {
+				fresh[turn] = entry
+				continue
+			} else if !ok && turn != latest {
+				// read on demand
+				continue
+			}
+			if entry, err = s.load(src); err != nil {
+				return err
+			} else if entry.turn != turn {
+				return fmt.Errorf("%s: galaxy.dat is turn %d, not %d", src.path, entry.turn, turn)
+			}
+			fresh[turn] = entry
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// turns that were reloaded keep their place in the cache
+	lru, loaded := list.New(), make(map[int]*list.Element)
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		turn := e.Value.(*storeEntry).turn
+		if entry, ok := fresh[turn]; ok {
+			loaded[turn] = lru.PushBack(entry)
+		}
+	}
+	for turn, entry := range fresh {
+		if _, ok := loaded[turn]; !ok {
+			loaded[turn] = lru.PushFront(entry)
+		}
+	}
+	for lru.Len() > s.capacity {
+		oldest := lru.Remove(lru.Back()).(*storeEntry)
+		delete(loaded, oldest.turn)
+	}
+	s.sources, s.indexed, s.lru, s.loaded = sources, fingerprint(sources), lru, loaded
+	return nil
+}
+
+// Watch polls the root every interval and reloads the store after the
+// data files have stopped changing for the settle time, so that a turn
+// is not read while the engine is still writing it. The result of each
+// reload is passed to notify, which may be nil. Files that failed to
+// load are not retried until they change again.
+// Watch returns when the context is done.
+func (s *Store) Watch(ctx context.Context, interval, settle time.Duration, notify func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var w storeWatch
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if reloaded, err := s.poll(&w, now, settle); reloaded && notify != nil {
+				notify(err)
+			}
+		}
+	}
+}
+
+// storeWatch is the state that Watch keeps between polls.
+type storeWatch struct {
+	pending, failed string    // fingerprints
+	since           time.Time // when pending was first seen
+}
+
+// poll is one tick of Watch at the given time. It returns true if the
+// store was reloaded, along with the result of the reload.
+func (s *Store) poll(w *storeWatch, now time.Time, settle time.Duration) (bool, error) {
+	sources, err := s.index()
+	if err != nil {
+		// files come and go while a turn is being written
+		return false, nil
+	}
+	seen := fingerprint(sources)
+	s.mu.Lock()
+	indexed := s.indexed
+	s.mu.Unlock()
+	if seen == indexed || seen == w.failed {
+		w.pending = ""
+		return false, nil
+	} else if seen != w.pending {
+		w.pending, w.since = seen, now
+		return false, nil
+	} else if now.Sub(w.since) < settle {
+		return false, nil
+	}
+	w.pending = ""
+	if err = s.Reload(); err != nil {
+		w.failed = seen
+	}
+	return true, err
+}
+
+// index scans the root for turns. In single turn mode, the turn number
+// is not known until the data is read, so the source is returned as turn 0.
+func (s *Store) index() (map[int]source, error) {
+	if s.single {
+		stamp, err := stampOf(s.root)
+		if err != nil {
+			return nil, err
+		}
+		return map[int]source{0: {path: s.root, stamp: stamp}}, nil
+	}
+
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[int]source)
+	for _, e := range entries {
+		if e.IsDir() {
+			if !fileExists(filepath.Join(s.root, e.Name(), "galaxy.dat")) {
+				continue
+			}
+		} else if !IsArchive(e.Name()) {
+			continue
+		}
+		m := turnNumber.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		turn, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		if other, ok := sources[turn]; ok {
+			return nil, fmt.Errorf("store: turn %d: both %q and %q", turn, filepath.Base(other.path), e.Name())
+		}
+		src := source{path: filepath.Join(s.root, e.Name())}
+		if src.stamp, err = stampOf(src.path); err != nil {
+			return nil, err
+		}
+		sources[turn] = src
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%s: %w", s.root, ErrNoSuchTurn)
+	}
+	return sources, nil
+}
+
+// stampOf returns the size and modification time of an archive, or of
+// the galaxy and species files in a directory.
+func stampOf(dataPath string) (string, error) {
+	fi, err := os.Stat(dataPath)
+	if err != nil {
+		return "", err
+	} else if !fi.IsDir() {
+		return fmt.Sprintf("%d@%d", fi.Size(), fi.ModTime().UnixNano()), nil
+	}
+	names, err := filepath.Glob(filepath.Join(dataPath, "sp[0-9][0-9].dat"))
+	if err != nil {
+		return "", err
+	}
+	names = append([]string{filepath.Join(dataPath, "galaxy.dat")}, names...)
+	var sb strings.Builder
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s:%d@%d;", filepath.Base(name), fi.Size(), fi.ModTime().UnixNano())
+	}
+	return sb.String(), nil
+}
+
+// fingerprint combines the stamps of all the sources.
+func fingerprint(sources map[int]source) string {
+	paths := make([]string, 0, len(sources))
+	stamps := make(map[string]string)
+	for _, src := range sources {
+		paths = append(paths, src.path)
+		stamps[src.path] = src.stamp
+	}
+	sort.Strings(paths)
+	var sb strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&sb, "%s=%s\n", p, stamps[p])
+	}
+	return sb.String()
+}
+
+// Turns returns the turn numbers in the store, oldest first.
+func (s *Store) Turns() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	turns := make([]int, 0, len(s.sources))
+	for turn := range s.sources {
+		turns = append(turns, turn)
+	}
+	sort.Ints(turns)
+	return turns
+}
+
+// Latest returns the number of the most recent turn in the store.
+func (s *Store) Latest() int {
+	turns := s.Turns()
+	return turns[len(turns)-1]
+}
+
+// Load returns the cluster for the turn, reading it if it is not in memory.
+func (s *Store) Load(turn int) (*Cluster, *Layout, error) {
+	entry, err := s.entry(turn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry.cluster, entry.layout, nil
+}
+
+// View returns the turn as seen by a species; see Cluster.ViewFor.
+// Species zero is the game master, who sees the whole cluster.
+func (s *Store) View(turn, species int) (*Cluster, error) {
+	entry, err := s.entry(turn)
+	if err != nil {
+		return nil, err
+	} else if species == 0 {
+		return entry.cluster, nil
+	}
+	sp := entry.cluster.LookupSpecies(species)
+	if sp == nil {
+		return nil, fmt.Errorf("turn %d: species %d: %w", turn, species, ErrNoSuchSpecies)
+	}
+	entry.mu.Lock()
+	view, ok := entry.views[species]
+	if !ok {
+		view = &storeView{}
+		entry.views[species] = view
+	}
+	entry.mu.Unlock()
+	// other species' views are not held up while this one is built
+	view.once.Do(func() {
+		view.cluster = entry.cluster.ViewFor(sp)
+	})
+	return view.cluster, nil
+}
+
+// entry returns the loaded turn, reading it if it is not in memory and
+// evicting the least recently used turn if the store is full.
+// The turn is read without holding the lock, so requests for other turns
+// are not held up, and concurrent requests for the same turn share one read.
+func (s *Store) entry(turn int) (*storeEntry, error) {
+	s.mu.Lock()
+	if e, ok := s.loaded[turn]; ok {
+		s.lru.MoveToFront(e)
+		s.mu.Unlock()
+		return e.Value.(*storeEntry), nil
+	}
+	if l, ok := s.loading[turn]; ok {
+		s.mu.Unlock()
+		<-l.done
+		return l.entry, l.err
+	}
+	src, ok := s.sources[turn]
+	if !ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("turn %d: %w", turn, ErrNoSuchTurn)
+	}
+	l := &storeLoad{done: make(chan struct{})}
+	s.loading[turn] = l
+	s.mu.Unlock()
+
+	s.read(turn, src, l)
+	return l.entry, l.err
+}
+
+// read reads the turn for entry and adds it to the cache.
+// The requests waiting on the read are released even if it panics.
+func (s *Store) read(turn int, src source, l *storeLoad) {
+	l.err = fmt.Errorf("%s: turn %d: read failed", src.path, turn)
+	defer func() {
+		s.mu.Lock()
+		delete(s.loading, turn)
+		// a Reload while the turn was being read may have loaded it already
+		// or replaced its source; the entry is returned but not kept then
+		if _, ok := s.loaded[turn]; l.err == nil && !ok && s.sources[turn] == src {
+			s.loaded[turn] = s.lru.PushFront(l.entry)
+			for s.lru.Len() > s.capacity {
+				oldest := s.lru.Remove(s.lru.Back()).(*storeEntry)
+				delete(s.loaded, oldest.turn)
+			}
+		}
+		s.mu.Unlock()
+		close(l.done)
+	}()
+	entry, err := s.load(src)
+	if err == nil && entry.turn != turn {
+		entry, err = nil, fmt.Errorf("%s: galaxy.dat is turn %d, not %d", src.path, entry.turn, turn)
+	}
+	l.entry, l.err = entry, err
+}
+
+func (s *Store) load(src source) (*storeEntry, error) {
+	fsys, err := OpenDataFS(src.path)
+	if err != nil {
+		return nil, err
+	}
+	cluster, layout := (*Cluster)(nil), s.layout
+	if layout == nil {
+		cluster, layout, err = LoadFromFSAuto(fsys)
+	} else {
+		cluster, err = LoadFromFS(fsys, layout)
+	}
+	if err != nil {
+		return nil, withDataPath(src.path, err)
+	}
+	return &storeEntry{turn: cluster.Turn, stamp: src.stamp, cluster: cluster, layout: layout, views: make(map[int]*storeView)}, nil
+}
+
+func fileExists(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.Mode().IsRegular()
+}
@@ -0,0 +1,265 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTestStore opens a store of the turns, with a capacity of one.
+func openTestStore(t *testing.T, turns ...int) *Store {
+	t.Helper()
+	root := t.TempDir()
+	for _, turn := range turns {
+		dir := filepath.Join(root, fmt.Sprintf("t%d", turn))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeTestFiles(t, dir, NewLayout(binary.LittleEndian), turn)
+	}
+	s, err := OpenStore(root, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStoreConcurrentLoads(t *testing.T) {
+	s := openTestStore(t, 26, 27)
+
+	// turn 26 is not in memory; every request must get the same read
+	const n = 16
+	clusters := make([]*Cluster, n)
+	views := make([]*Cluster, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				clusters[i], _, err = s.Load(26)
+			} else {
+				views[i], err = s.View(26, 1)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	want, _, err := s.Load(26)
+	if err != nil {
+		t.Fatal(err)
+	} else if want.Turn != 26 {
+		t.Fatalf("turn: want 26: got %d", want.Turn)
+	}
+	wantView, err := s.View(26, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if i%2 == 0 && clusters[i] != want {
+			t.Errorf("Load %d: got a different cluster", i)
+		} else if i%2 != 0 && views[i] != wantView {
+			t.Errorf("View %d: got a different view", i)
+		}
+	}
+
+	// the capacity is one, so turn 27 is read again and replaces 26
+	if c, _, err := s.Load(27); err != nil || c.Turn != 27 {
+		t.Fatalf("Load 27: want turn 27: got %v", err)
+	}
+	if c, _, err := s.Load(26); err != nil || c == want {
+		t.Errorf("Load 26: want a new read: got %v", err)
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	s := openTestStore(t, 27)
+	if _, _, err := s.Load(5); !errors.Is(err, ErrNoSuchTurn) {
+		t.Errorf("Load 5: want ErrNoSuchTurn: got %v", err)
+	}
+	if _, err := s.View(27, 3); !errors.Is(err, ErrNoSuchSpecies) {
+		t.Errorf("View 27 3: want ErrNoSuchSpecies: got %v", err)
+	}
+	if c, err := s.View(27, 0); err != nil || c.Turn != 27 || len(c.Species) != 2 {
+		t.Errorf("View 27 0: want the whole cluster: got %v", err)
+	}
+}
+
+// touchTurn gives the turn's galaxy file a new modification time,
+// which changes the turn's stamp without changing its data.
+func touchTurn(t *testing.T, s *Store, turn int, mtime time.Time) {
+	t.Helper()
+	name := filepath.Join(s.root, fmt.Sprintf("t%d", turn), "galaxy.dat")
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addTestTurn writes the files for a new turn into the store's root.
+func addTestTurn(t *testing.T, s *Store, turn int) string {
+	t.Helper()
+	dir := filepath.Join(s.root, fmt.Sprintf("t%d", turn))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFiles(t, dir, NewLayout(binary.LittleEndian), turn)
+	return dir
+}
+
+func TestStoreWatchSettle(t *testing.T) {
+	s := openTestStore(t, 26, 27)
+	var w storeWatch
+	start, settle := time.Unix(1_000_000, 0), 5*time.Second
+
+	// nothing has changed since the store was opened
+	if reloaded, _ := s.poll(&w, start, settle); reloaded {
+		t.Fatal("unchanged: want no reload")
+	}
+
+	addTestTurn(t, s, 28)
+	for _, tick := range []time.Duration{0, time.Second, 3 * time.Second} {
+		if reloaded, _ := s.poll(&w, start.Add(tick), settle); reloaded {
+			t.Fatalf("%v: want no reload before the files settle", tick)
+		}
+	}
+	// the files change again, so the settle time starts over
+	touchTurn(t, s, 28, start.Add(4*time.Second))
+	for _, tick := range []time.Duration{4 * time.Second, 8 * time.Second} {
+		if reloaded, _ := s.poll(&w, start.Add(tick), settle); reloaded {
+			t.Fatalf("%v: want no reload before the files settle again", tick)
+		}
+	}
+	if s.Latest() != 27 {
+		t.Fatalf("latest: want 27 before the reload: got %d", s.Latest())
+	}
+	if reloaded, err := s.poll(&w, start.Add(9*time.Second), settle); !reloaded || err != nil {
+		t.Fatalf("9s: want a reload: got %v %v", reloaded, err)
+	} else if s.Latest() != 28 {
+		t.Fatalf("latest: want 28: got %d", s.Latest())
+	}
+
+	// the new index matches the files, so there is nothing more to do
+	for _, tick := range []time.Duration{10 * time.Second, time.Minute} {
+		if reloaded, _ := s.poll(&w, start.Add(tick), settle); reloaded {
+			t.Fatalf("%v: unchanged: want no reload", tick)
+		}
+	}
+}
+
+func TestStoreWatchFailedLoad(t *testing.T) {
+	s := openTestStore(t, 26, 27)
+	var w storeWatch
+	start, settle := time.Unix(1_000_000, 0), time.Second
+	before, _, err := s.Load(27)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a latest turn that can't be read is not swapped in
+	dir := addTestTurn(t, s, 28)
+	truncateFile(t, filepath.Join(dir, "sp01.dat"), 1)
+	s.poll(&w, start, settle)
+	if reloaded, err := s.poll(&w, start.Add(settle), settle); !reloaded || err == nil {
+		t.Fatalf("want a failed reload: got %v %v", reloaded, err)
+	}
+	if s.Latest() != 27 || !reflect.DeepEqual(s.Turns(), []int{26, 27}) {
+		t.Errorf("turns: want 26 and 27: got %v", s.Turns())
+	}
+	if c, _, err := s.Load(27); err != nil || c != before {
+		t.Errorf("Load 27: want the cluster from before the reload: got %v", err)
+	}
+
+	// the same files are not read again
+	for _, tick := range []time.Duration{2 * time.Second, time.Minute} {
+		if reloaded, _ := s.poll(&w, start.Add(tick), settle); reloaded {
+			t.Fatalf("%v: want no retry of the failed files", tick)
+		}
+	}
+
+	// until they are fixed
+	writeTestFiles(t, dir, NewLayout(binary.LittleEndian), 28)
+	touchTurn(t, s, 28, start.Add(time.Hour))
+	s.poll(&w, start.Add(2*time.Minute), settle)
+	if reloaded, err := s.poll(&w, start.Add(3*time.Minute), settle); !reloaded || err != nil {
+		t.Fatalf("want a reload: got %v %v", reloaded, err)
+	} else if s.Latest() != 28 {
+		t.Errorf("latest: want 28: got %d", s.Latest())
+	}
+}
+
+func TestStoreReloadEvicted(t *testing.T) {
+	// the capacity is one, so loading 26 and then 27 evicts 26
+	s := openTestStore(t, 26, 27)
+	old26, _, err := s.Load(26)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Load(27); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.loaded[26]; ok {
+		t.Fatal("26: want it evicted")
+	}
+
+	// a change to an evicted turn is indexed but not read
+	touchTurn(t, s, 26, time.Unix(2_000_000, 0))
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.loaded[26]; ok || s.lru.Len() != 1 {
+		t.Errorf("26: want it left on disk: got %d turns in memory", s.lru.Len())
+	}
+	new26, _, err := s.Load(26)
+	if err != nil {
+		t.Fatal(err)
+	} else if new26 == old26 {
+		t.Error("Load 26: want a new read: got the evicted cluster")
+	}
+	if stamp := s.loaded[26].Value.(*storeEntry).stamp; stamp != s.sources[26].stamp {
+		t.Errorf("26: want the new stamp: got %q", stamp)
+	}
+
+	// a change to a turn in memory is read, and the store stays at capacity
+	touchTurn(t, s, 26, time.Unix(3_000_000, 0))
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s.lru.Len() != 1 || len(s.loaded) != 1 {
+		t.Errorf("want one turn in memory: got %d", s.lru.Len())
+	}
+	if c, _, err := s.Load(26); err != nil || c == new26 {
+		t.Errorf("Load 26: want the changed turn: got %v", err)
+	}
+}
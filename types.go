@@ -23,11 +23,15 @@
 
 package fhdata
 
-import "fmt"
+import (
+	"fmt"
+	"math/bits"
+)
 
 type AtmosphericGas struct {
 	Gas
-	Pct int
+	Pct  int
+	Slot int // position of the gas in the planet's data, starting at 0
 }
 
 type Cluster struct {
@@ -67,6 +71,9 @@ func (c Coords) String() string {
 	return fmt.Sprintf("%d, %d, %d", c.X, c.Y, c.Z)
 }
 
+// Colony is a named planet of a species.
+// Status holds the status bits from the data file and is what is saved;
+// the matching Is flags are derived from it when the cluster is loaded.
 type Colony struct {
 	Id         int
 	Coords     Coords
@@ -97,9 +104,10 @@ type Colony struct {
 	SiegeEffPct       int
 	Species           *Species
 	Special           int
-	Status            int
+	Status            int // HOME_PLANET, COLONY, POPULATED and so on, ORed together
 	System            *System
 	UseOnAmbush       int
+	reserved          namplaReserved
 }
 
 type Develop struct {
@@ -124,6 +132,7 @@ type Item struct {
 
 type Location struct {
 	Colony *Colony
+	Coords Coords
 	Planet *Planet
 	System *System
 }
@@ -149,8 +158,13 @@ type Planet struct {
 	PressureClass            int
 	System                   *System
 	TemperatureClass         int
+	reserved                 planetReserved
 }
 
+// Ship is a ship of a species.
+// Status is what is saved; the ForcedJump, InDeepSpace, InOrbit, JumpedInCombat,
+// OnSurface and UnderConstruction flags are derived from it when the cluster is loaded.
+// Likewise Type is saved and SubLight is derived from it and the class.
 type Ship struct {
 	Id                 int
 	Age                int
@@ -158,7 +172,7 @@ type Ship struct {
 	Class              string
 	CargoCapacity      int
 	Coords             Coords
-	Destination        *Location
+	Destination        *Location // nil if none, or if the destination is 0,0,0
 	ForcedJump         bool
 	Hiding             bool
 	InDeepSpace        bool
@@ -168,6 +182,7 @@ type Ship struct {
 	JustJumped         bool
 	LoadingPoint       *Colony
 	Location           Location
+	MaintenanceCost    int // cost per turn, after the military discount rounded for this ship alone
 	Name               string
 	OnSurface          bool
 	Orbit              int // the first orbit is 1
@@ -175,12 +190,36 @@ type Ship struct {
 	Size               int // meaningful only for transports
 	Special            int
 	Species            *Species
-	Status             int
+	Status             ShipStatus
 	SubLight           bool
 	Tonnage            int
 	TotalCost          int
+	Type               int // FTL, SUB_LIGHT or STARBASE
 	UnderConstruction  bool
 	UnloadingPoint     *Colony
+	reserved           shipReserved
+}
+
+// ShipStatus is the status code of a ship.
+type ShipStatus int
+
+func (s ShipStatus) String() string {
+	switch s {
+	case UNDER_CONSTRUCTION:
+		return "Under Construction"
+	case ON_SURFACE:
+		return "On Surface"
+	case IN_ORBIT:
+		return "In Orbit"
+	case IN_DEEP_SPACE:
+		return "In Deep Space"
+	case JUMPED_IN_COMBAT:
+		return "Jumped In Combat"
+	case FORCED_JUMP:
+		return "Forced Jump"
+	default:
+		return fmt.Sprintf("ShipStatus(%d)", int(s))
+	}
 }
 
 type Species struct {
@@ -214,6 +253,7 @@ type Species struct {
 	SystemsScanned         []*System
 	SystemsVisited         []*System
 	BI, GV, LS, MA, MI, ML Tech
+	reserved               speciesReserved
 }
 
 type StarColor struct {
@@ -240,6 +280,7 @@ type System struct {
 	Type         StarType
 	VisitedBy    map[string]*Species
 	WormholeExit *System
+	reserved     starReserved
 }
 
 type Tech struct {
@@ -267,6 +308,15 @@ const (
 	IN_DEEP_SPACE      = 3
 	JUMPED_IN_COMBAT   = 4
 	FORCED_JUMP        = 5
+	// Ship types.
+	FTL       = 0
+	SUB_LIGHT = 1
+	STARBASE  = 2
+	// Orbit of a ship record that is not in use, such as a destroyed ship.
+	// The engine skips these ships.
+	UNUSED_SHIP_ORBIT = 99
+	// Highest species number that fits in a species bitset.
+	MAX_SPECIES = 112
 )
 
 // galaxy_data is the layout in the binary data file.
@@ -431,6 +481,72 @@ type ship_data struct {
 	MorePadding [2]uint8
 }
 
+// speciesBitset is the layout of the species bitsets in the binary data files.
+// The bit for species number sp (1 based!) is bit sp+15, counting from the
+// low bit of the first word through the high bit of the second word.
+//
+//	sp01       65536                       1 0000 0000 0000 0000
+//	sp09    16777216             1 0000 0000 0000 0000 0000 0000
+//	sp18  8589934592  10 0000 0000 0000 0000 0000 0000 0000 0000
+//
+// The table is carried over from the original reader of the data files
+// and fixes the offset. The limit comes from the records, not the engine:
+// Contact, Ally and Enemy in species_data and VisitedBy in star_data are
+// 16 bytes each, fixed by the 264 byte species record and the star record.
+// With the offset, the low 16 bits of the first word are never used, so
+// the set holds 112 species, not 128, and the highest species number that
+// can be stored is MAX_SPECIES.
+type speciesBitset [2]uint64
+
+// speciesBitsetOffset is the bit number of species number zero.
+const speciesBitsetOffset = 15
+
+// Clear clears the bit for the species.
+// It does nothing if the species number is out of range.
+func (b *speciesBitset) Clear(sp int) {
+	if word, mask, ok := speciesBitsetMask(sp); ok {
+		b[word] &^= mask
+	}
+}
+
+// Count returns the number of species in the set.
+func (b speciesBitset) Count() int {
+	return bits.OnesCount64(b[0]>>(speciesBitsetOffset+1)) + bits.OnesCount64(b[1])
+}
+
+// Each calls fn with the number of each species in the set, in ascending order.
+func (b speciesBitset) Each(fn func(sp int)) {
+	for sp := 1; sp <= MAX_SPECIES; sp++ {
+		if b.IsSet(sp) {
+			fn(sp)
+		}
+	}
+}
+
+// IsSet returns true if the bit is set for the species.
+// It returns false if the species number is out of range.
+func (b speciesBitset) IsSet(sp int) bool {
+	word, mask, ok := speciesBitsetMask(sp)
+	return ok && b[word]&mask != 0
+}
+
+// Set sets the bit for the species.
+// It does nothing if the species number is out of range.
+func (b *speciesBitset) Set(sp int) {
+	if word, mask, ok := speciesBitsetMask(sp); ok {
+		b[word] |= mask
+	}
+}
+
+// speciesBitsetMask returns the word and mask for the species bit.
+func speciesBitsetMask(sp int) (word int, mask uint64, ok bool) {
+	if !(0 < sp && sp <= MAX_SPECIES) {
+		return 0, 0, false
+	}
+	bit := sp + speciesBitsetOffset
+	return bit / 64, 1 << (bit % 64), true
+}
+
 // species_data is the layout in the binary data file.
 type species_data struct {
 	/* Name of species. */
@@ -482,11 +598,11 @@ type species_data struct {
 	/* Fleet maintenance cost as a percentage times one hundred. */
 	FleetPercentCost int32
 	/* A bit is set if corresponding species has been met. */
-	Contact [2]uint64
+	Contact speciesBitset
 	/* A bit is set if corresponding species is considered an ally. */
-	Ally [2]uint64
+	Ally speciesBitset
 	/* A bit is set if corresponding species is considered an enemy. */
-	Enemy [2]uint64
+	Enemy speciesBitset
 	/* Use for expansion. Initialized to all zeroes. */
 	Padding [12]uint8
 }
@@ -498,6 +614,52 @@ type species_file struct {
 	ships   []ship_data
 }
 
+// The reserved and padding fields of each record are kept when the
+// cluster is loaded and written back when it is saved, so that saving
+// does not change bytes that the engine or other tools may use.
+
+type namplaReserved struct {
+	Reserved1 uint8
+	Reserved2 int16
+	Reserved4 int32
+	Reserved5 int32
+	Reserved6 int32
+	Padding   [28]uint8
+}
+
+type planetReserved struct {
+	Reserved1 int8
+	Reserved2 int16
+	Reserved3 int32
+	Reserved4 int32
+	Reserved5 int32
+}
+
+type shipReserved struct {
+	Reserved1   uint8
+	Reserved2   int16
+	Reserved3   int16
+	Reserved4   int16
+	Padding     [28]uint8
+	MorePadding [2]uint8
+}
+
+type speciesReserved struct {
+	Reserved3 uint8
+	Reserved4 int16
+	Reserved5 uint8
+	Padding   [12]uint8
+}
+
+type starReserved struct {
+	Reserved1 int16
+	Reserved2 int16
+	Reserved3 int32
+	Reserved4 int32
+	Reserved5 int32
+	Padding   [2]uint8
+}
+
 // star_data is the layout in the binary data file.
 type star_data struct {
 	/* Coordinates. */
@@ -528,7 +690,7 @@ type star_data struct {
 	/* Message associated with this star system, if any. */
 	Message int32
 	/* A bit is set if corresponding species has been here. */
-	VisitedBy [2]uint64
+	VisitedBy speciesBitset
 	/* Reserved for future use. Zero for now. */
 	Reserved3 int32
 	Reserved4 int32
@@ -0,0 +1,169 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpeciesBitset(t *testing.T) {
+	for _, tc := range []struct {
+		sp   int
+		want speciesBitset // the words after Set
+		ok   bool          // the species number is in range
+	}{
+		{0, speciesBitset{}, false},
+		{1, speciesBitset{1 << 16, 0}, true},
+		{48, speciesBitset{1 << 63, 0}, true},
+		{49, speciesBitset{0, 1}, true},
+		{MAX_SPECIES, speciesBitset{0, 1 << 63}, true},
+		{MAX_SPECIES + 1, speciesBitset{}, false},
+	} {
+		var b speciesBitset
+		b.Set(tc.sp)
+		if b != tc.want {
+			t.Errorf("sp %d: Set: want %#x: got %#x", tc.sp, tc.want, b)
+		}
+		if b.IsSet(tc.sp) != tc.ok {
+			t.Errorf("sp %d: IsSet: want %v: got %v", tc.sp, tc.ok, !tc.ok)
+		}
+		wantCount, wantEach := 0, []int(nil)
+		if tc.ok {
+			wantCount, wantEach = 1, []int{tc.sp}
+		}
+		if got := b.Count(); got != wantCount {
+			t.Errorf("sp %d: Count: want %d: got %d", tc.sp, wantCount, got)
+		}
+		var each []int
+		b.Each(func(sp int) { each = append(each, sp) })
+		if !reflect.DeepEqual(each, wantEach) {
+			t.Errorf("sp %d: Each: want %v: got %v", tc.sp, wantEach, each)
+		}
+		// the neighbours are not touched
+		for _, sp := range []int{tc.sp - 1, tc.sp + 1} {
+			if sp != tc.sp && b.IsSet(sp) {
+				t.Errorf("sp %d: IsSet(%d): want false: got true", tc.sp, sp)
+			}
+		}
+		b.Clear(tc.sp)
+		if b != (speciesBitset{}) {
+			t.Errorf("sp %d: Clear: want 0: got %#x", tc.sp, b)
+		}
+	}
+}
+
+func TestSpeciesBitsetAll(t *testing.T) {
+	var b speciesBitset
+	for sp := 0; sp <= MAX_SPECIES+1; sp++ {
+		b.Set(sp)
+	}
+	if want := (speciesBitset{0xffff_ffff_ffff_0000, 0xffff_ffff_ffff_ffff}); b != want {
+		t.Errorf("Set: want %#x: got %#x", want, b)
+	}
+	if got := b.Count(); got != MAX_SPECIES {
+		t.Errorf("Count: want %d: got %d", MAX_SPECIES, got)
+	}
+	n := 0
+	b.Each(func(sp int) {
+		if n++; sp != n {
+			t.Errorf("Each: want %d: got %d", n, sp)
+		}
+	})
+	if n != MAX_SPECIES {
+		t.Errorf("Each: want %d calls: got %d", MAX_SPECIES, n)
+	}
+}
+
+func TestSpeciesBitsetCountIgnoresLowBits(t *testing.T) {
+	// the low 16 bits of the first word are not species
+	b := speciesBitset{0xffff, 0}
+	if got := b.Count(); got != 0 {
+		t.Errorf("Count: want 0: got %d", got)
+	}
+	b.Set(1)
+	b.Set(MAX_SPECIES)
+	if got := b.Count(); got != 2 {
+		t.Errorf("Count: want 2: got %d", got)
+	}
+	var each []int
+	b.Each(func(sp int) { each = append(each, sp) })
+	if want := []int{1, MAX_SPECIES}; !reflect.DeepEqual(each, want) {
+		t.Errorf("Each: want %v: got %v", want, each)
+	}
+}
+
+func TestSpeciesBitsetEngineValues(t *testing.T) {
+	// the values from the table on speciesBitset, for a single species
+	for _, tc := range []struct {
+		sp   int
+		word uint64
+	}{
+		{1, 65536},
+		{9, 16777216},
+		{18, 8589934592},
+	} {
+		var b speciesBitset
+		b.Set(tc.sp)
+		if b[0] != tc.word || b[1] != 0 {
+			t.Errorf("sp %d: want %d: got %d %d", tc.sp, tc.word, b[0], b[1])
+		}
+		if !(speciesBitset{tc.word, 0}).IsSet(tc.sp) {
+			t.Errorf("sp %d: IsSet(%d): want true: got false", tc.sp, tc.word)
+		}
+	}
+}
+
+func TestSpeciesBitsetBoundary(t *testing.T) {
+	// species 112 is the high bit of the second word, and 113 does not fit
+	var b speciesBitset
+	b.Set(112)
+	if want := (speciesBitset{0, 1 << 63}); b != want {
+		t.Errorf("Set(112): want %#x: got %#x", want, b)
+	}
+	full := speciesBitset{^uint64(0), ^uint64(0)}
+	for _, set := range []speciesBitset{{}, b, full} {
+		got := set
+		got.Set(113)
+		if got != set {
+			t.Errorf("%#x: Set(113): want no change: got %#x", set, got)
+		}
+		got.Clear(113)
+		if got != set {
+			t.Errorf("%#x: Clear(113): want no change: got %#x", set, got)
+		}
+		if got.IsSet(113) {
+			t.Errorf("%#x: IsSet(113): want false: got true", set)
+		}
+	}
+	// every bit set, as a corrupt file might have it, is 112 species
+	if got := full.Count(); got != 112 {
+		t.Errorf("Count: want 112: got %d", got)
+	}
+	last := 0
+	full.Each(func(sp int) { last = sp })
+	if last != 112 {
+		t.Errorf("Each: want last 112: got %d", last)
+	}
+}
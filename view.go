@@ -0,0 +1,313 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+// ViewFor returns the cluster as seen by a single species.
+// The view is a copy of the cluster graph that contains
+//   - the systems the species has scanned or visited, plus any
+//     system holding one of its colonies or ships,
+//   - the planets in those systems,
+//   - the species itself and the species it has contacted,
+//   - all of its own colonies and ships, and
+//   - the colonies and ships of contacted species that are in
+//     a scanned system and are not hidden.
+//
+// The economy, tech levels and diplomacy of other species are
+// cleared, as are the orders, cargo and economy of their colonies
+// and the orders, cargo and accounts of their ships.
+// Ids are unchanged, so the slices in the view may be sparse; use
+// the Lookup methods rather than indexing them.
+func (c *Cluster) ViewFor(species *Species) *Cluster {
+	v := &view{
+		viewer:   species,
+		systems:  make(map[*System]*System),
+		planets:  make(map[*Planet]*Planet),
+		species:  make(map[*Species]*Species),
+		colonies: make(map[*Colony]*Colony),
+		ships:    make(map[*Ship]*Ship),
+		scanned:  make(map[*System]bool),
+	}
+	return v.build(c)
+}
+
+// LookupPlanet returns the planet with the given id, or nil.
+func (c *Cluster) LookupPlanet(id int) *Planet {
+	if 0 < id && id <= len(c.Planets) && c.Planets[id-1].Id == id {
+		return c.Planets[id-1]
+	}
+	for _, planet := range c.Planets {
+		if planet.Id == id {
+			return planet
+		}
+	}
+	return nil
+}
+
+// LookupSpecies returns the species with the given id, or nil.
+func (c *Cluster) LookupSpecies(id int) *Species {
+	if 0 < id && id <= len(c.Species) && c.Species[id-1].Id == id {
+		return c.Species[id-1]
+	}
+	for _, species := range c.Species {
+		if species.Id == id {
+			return species
+		}
+	}
+	return nil
+}
+
+// LookupSystem returns the system with the given id, or nil.
+func (c *Cluster) LookupSystem(id int) *System {
+	if 0 < id && id <= len(c.Systems) && c.Systems[id-1].Id == id {
+		return c.Systems[id-1]
+	}
+	for _, system := range c.Systems {
+		if system.Id == id {
+			return system
+		}
+	}
+	return nil
+}
+
+// LookupColony returns the colony with the given id, or nil.
+func (sp *Species) LookupColony(id int) *Colony {
+	if 0 < id && id <= len(sp.Colonies) && sp.Colonies[id-1].Id == id {
+		return sp.Colonies[id-1]
+	}
+	for _, colony := range sp.Colonies {
+		if colony.Id == id {
+			return colony
+		}
+	}
+	return nil
+}
+
+// LookupShip returns the ship with the given id, or nil.
+func (sp *Species) LookupShip(id int) *Ship {
+	if 0 < id && id <= len(sp.Ships) && sp.Ships[id-1].Id == id {
+		return sp.Ships[id-1]
+	}
+	for _, ship := range sp.Ships {
+		if ship.Id == id {
+			return ship
+		}
+	}
+	return nil
+}
+
+// view maps objects in the full cluster to their copies in the view.
+type view struct {
+	viewer   *Species
+	systems  map[*System]*System
+	planets  map[*Planet]*Planet
+	species  map[*Species]*Species
+	colonies map[*Colony]*Colony
+	ships    map[*Ship]*Ship
+	scanned  map[*System]bool // systems where other species can be seen
+}
+
+func (v *view) build(c *Cluster) *Cluster {
+	vc := &Cluster{Turn: c.Turn, Radius: c.Radius, DesignedNumSpecies: c.DesignedNumSpecies}
+
+	// the viewer can always see the systems it has been to or is in
+	visible := make(map[*System]bool)
+	for _, system := range v.viewer.SystemsScanned {
+		visible[system], v.scanned[system] = true, true
+	}
+	for _, system := range v.viewer.SystemsVisited {
+		visible[system] = true
+	}
+	for _, colony := range v.viewer.Colonies {
+		if colony.System != nil {
+			visible[colony.System] = true
+		}
+	}
+	for _, ship := range v.viewer.Ships {
+		if ship.Location.System != nil {
+			visible[ship.Location.System] = true
+		}
+	}
+
+	for _, system := range c.Systems {
+		if !visible[system] {
+			continue
+		}
+		cp := *system
+		cp.Planets, cp.ScannedBy, cp.VisitedBy = nil, make(map[string]*Species), make(map[string]*Species)
+		v.systems[system] = &cp
+		vc.Systems = append(vc.Systems, &cp)
+	}
+	for _, system := range c.Systems {
+		if cp, ok := v.systems[system]; ok {
+			cp.WormholeExit = v.systems[system.WormholeExit]
+		}
+	}
+
+	for _, planet := range c.Planets {
+		system, ok := v.systems[planet.System]
+		if !ok {
+			continue
+		}
+		cp := *planet
+		cp.System, cp.Colonies = system, nil
+		cp.LSN = make([]int, len(planet.LSN))
+		if i := v.viewer.Id - 1; 0 <= i && i < len(planet.LSN) {
+			cp.LSN[i] = planet.LSN[i]
+		}
+		v.planets[planet] = &cp
+		system.Planets = append(system.Planets, &cp)
+		vc.Planets = append(vc.Planets, &cp)
+	}
+
+	for _, species := range c.Species {
+		if species != v.viewer && v.viewer.Contacts[species.Name] != species {
+			continue
+		}
+		cp := *species
+		cp.Colonies, cp.Ships = nil, nil
+		cp.Allies, cp.Contacts, cp.Enemies = make(map[string]*Species), make(map[string]*Species), make(map[string]*Species)
+		cp.SystemsScanned, cp.SystemsVisited = nil, nil
+		if species != v.viewer {
+			cp.AutoOrders = false
+			cp.EconUnitsBanked, cp.EconUnitsProduced = 0, 0
+			cp.FleetMaintenanceCost, cp.FleetMaintenancePct = 0, 0
+			cp.HomePlanetOriginalBase = 0
+			cp.BI, cp.GV, cp.LS, cp.MA, cp.MI, cp.ML = redactTech(cp.BI), redactTech(cp.GV), redactTech(cp.LS), redactTech(cp.MA), redactTech(cp.MI), redactTech(cp.ML)
+		}
+		v.species[species] = &cp
+		vc.Species = append(vc.Species, &cp)
+	}
+
+	for species, cp := range v.species {
+		for _, colony := range species.Colonies {
+			if species == v.viewer || (v.scanned[colony.System] && !colony.Is.Hidden) {
+				v.addColony(cp, colony)
+			}
+		}
+	}
+	for species, cp := range v.species {
+		for _, ship := range species.Ships {
+			if species == v.viewer || (v.scanned[ship.Location.System] && !ship.Hiding && !ship.UnderConstruction) {
+				v.addShip(cp, ship)
+			}
+		}
+	}
+	// planets list colonies in species order, as in the full cluster
+	for _, planet := range c.Planets {
+		if cp, ok := v.planets[planet]; ok {
+			for _, colony := range planet.Colonies {
+				if colonyCp, ok := v.colonies[colony]; ok {
+					cp.Colonies = append(cp.Colonies, colonyCp)
+				}
+			}
+		}
+	}
+
+	// only the viewer's own history and diplomacy are known
+	viewer := v.species[v.viewer]
+	for _, system := range v.viewer.SystemsScanned {
+		viewer.SystemsScanned = append(viewer.SystemsScanned, v.systems[system])
+		v.systems[system].ScannedBy[viewer.Name] = viewer
+	}
+	for _, system := range v.viewer.SystemsVisited {
+		viewer.SystemsVisited = append(viewer.SystemsVisited, v.systems[system])
+		v.systems[system].VisitedBy[viewer.Name] = viewer
+	}
+	for name, other := range v.viewer.Contacts {
+		viewer.Contacts[name] = v.species[other]
+	}
+	for name, other := range v.viewer.Allies {
+		if cp, ok := v.species[other]; ok {
+			viewer.Allies[name] = cp
+		}
+	}
+	for name, other := range v.viewer.Enemies {
+		if cp, ok := v.species[other]; ok {
+			viewer.Enemies[name] = cp
+		}
+	}
+	for species, cp := range v.species {
+		cp.HomeColony = v.colonies[species.HomeColony]
+		cp.HomePlanet = v.planets[species.HomePlanet]
+		cp.HomeSystem = v.systems[species.HomeSystem]
+	}
+
+	return vc
+}
+
+func (v *view) addColony(species *Species, colony *Colony) {
+	cp := *colony
+	cp.Species, cp.System, cp.Planet = species, v.systems[colony.System], v.planets[colony.Planet]
+	if colony.DevelopAUs != nil {
+		develop := *colony.DevelopAUs
+		cp.DevelopAUs = &develop
+	}
+	if colony.DevelopIUs != nil {
+		develop := *colony.DevelopIUs
+		cp.DevelopIUs = &develop
+	}
+	cp.Inventory = append([]Item(nil), colony.Inventory...)
+	if colony.Species != v.viewer {
+		cp.DevelopAUs, cp.DevelopIUs, cp.Inventory = nil, nil, nil
+		cp.Message, cp.UseOnAmbush = 0, 0
+		cp.PopulationUnits, cp.MiningBase, cp.ManufacturingBase, cp.Production = 0, 0, 0, 0
+	}
+	v.colonies[colony] = &cp
+	species.Colonies = append(species.Colonies, &cp)
+}
+
+func (v *view) addShip(species *Species, ship *Ship) {
+	cp := *ship
+	cp.Species = species
+	cp.Location = v.location(ship.Location)
+	if ship.Destination != nil {
+		destination := v.location(*ship.Destination)
+		cp.Destination = &destination
+	}
+	cp.LoadingPoint, cp.UnloadingPoint = v.colonies[ship.LoadingPoint], v.colonies[ship.UnloadingPoint]
+	cp.Inventory = append([]Item(nil), ship.Inventory...)
+	if ship.Species != v.viewer {
+		// another species' orders, cargo and accounts are private
+		cp.Destination, cp.LoadingPoint, cp.UnloadingPoint, cp.Inventory = nil, nil, nil, nil
+		cp.MaintenanceCost, cp.RemainingCost, cp.TotalCost = 0, 0, 0
+	}
+	v.ships[ship] = &cp
+	species.Ships = append(species.Ships, &cp)
+}
+
+// location maps a location into the view, dropping the parts that
+// the viewer can not see. The coordinates are always kept.
+func (v *view) location(l Location) Location {
+	return Location{
+		Colony: v.colonies[l.Colony],
+		Coords: l.Coords,
+		Planet: v.planets[l.Planet],
+		System: v.systems[l.System],
+	}
+}
+
+// redactTech hides everything about a technology except its name.
+func redactTech(t Tech) Tech {
+	return Tech{Code: t.Code, Name: t.Name}
+}
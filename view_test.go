@@ -0,0 +1,153 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newViewTestCluster returns a cluster where Alpha has scanned the first
+// system and visited the second, has met Beta but not Gamma, and where
+// every species has a colony in the first system.
+func newViewTestCluster() *Cluster {
+	s1 := &System{Id: 1, Coords: Coords{X: 1}}
+	s2 := &System{Id: 2, Coords: Coords{X: 2}}
+	s3 := &System{Id: 3, Coords: Coords{X: 3}}
+	p1 := &Planet{Id: 1, System: s1, Coords: s1.Coords, Orbit: 1, LSN: []int{1, 2, 3}}
+	p2 := &Planet{Id: 2, System: s2, Coords: s2.Coords, Orbit: 1, LSN: []int{4, 5, 6}}
+	p3 := &Planet{Id: 3, System: s3, Coords: s3.Coords, Orbit: 1, LSN: []int{7, 8, 9}}
+	s1.Planets, s2.Planets, s3.Planets = []*Planet{p1}, []*Planet{p2}, []*Planet{p3}
+
+	alpha := &Species{Id: 1, Name: "Alpha", EconUnitsBanked: 100, SystemsScanned: []*System{s1}, SystemsVisited: []*System{s1, s2}}
+	beta := &Species{Id: 2, Name: "Beta", EconUnitsBanked: 200, EconUnitsProduced: 50}
+	gamma := &Species{Id: 3, Name: "Gamma"}
+	alpha.Contacts = map[string]*Species{"Beta": beta}
+	beta.MI.Code, beta.MI.CurrentLevel = "MI", 12
+
+	colony := func(species *Species, id int, planet *Planet) *Colony {
+		c := &Colony{
+			Id: id, Name: species.Name + planet.System.Coords.String(), Species: species, Planet: planet, System: planet.System,
+			Coords: planet.Coords, Orbit: planet.Orbit,
+			PopulationUnits: 50, MiningBase: 300, ManufacturingBase: 400, Production: 120, Shipyards: 2,
+			Message: 7, UseOnAmbush: 3, Inventory: []Item{{Code: "CU", Quantity: 10}},
+			DevelopIUs: &Develop{Code: "IU", UnitsNeeded: 6},
+		}
+		species.Colonies = append(species.Colonies, c)
+		planet.Colonies = append(planet.Colonies, c)
+		return c
+	}
+	colony(alpha, 1, p1)
+	colony(beta, 1, p1)
+	colony(beta, 2, p2) // visited but not scanned
+	colony(beta, 3, p3) // neither
+	colony(gamma, 1, p1)
+	hidden := colony(beta, 4, p1)
+	hidden.Is.Hidden = true
+
+	return &Cluster{Systems: []*System{s1, s2, s3}, Planets: []*Planet{p1, p2, p3}, Species: []*Species{alpha, beta, gamma}}
+}
+
+func TestViewForVisibility(t *testing.T) {
+	c := newViewTestCluster()
+	v := c.ViewFor(c.Species[0])
+
+	var systems []int
+	for _, system := range v.Systems {
+		systems = append(systems, system.Id)
+	}
+	if want := []int{1, 2}; !reflect.DeepEqual(systems, want) {
+		t.Errorf("systems: want %v: got %v", want, systems)
+	}
+	if v.LookupSpecies(3) != nil {
+		t.Errorf("species 3: want hidden: not contacted")
+	}
+	beta := v.LookupSpecies(2)
+	if beta == nil {
+		t.Fatalf("species 2: want visible: contacted")
+	}
+	// only Beta's colony in the scanned system is seen; the hidden one is not
+	var colonies []int
+	for _, colony := range beta.Colonies {
+		colonies = append(colonies, colony.Id)
+	}
+	if want := []int{1}; !reflect.DeepEqual(colonies, want) {
+		t.Errorf("Beta colonies: want %v: got %v", want, colonies)
+	}
+	if p := v.LookupPlanet(1); len(p.Colonies) != 2 {
+		t.Errorf("planet 1: want the colonies of Alpha and Beta: got %d", len(p.Colonies))
+	}
+	if p := v.LookupPlanet(2); len(p.Colonies) != 0 {
+		t.Errorf("planet 2: want no colonies in a system that is not scanned: got %d", len(p.Colonies))
+	}
+}
+
+func TestViewForRedactsOtherSpecies(t *testing.T) {
+	c := newViewTestCluster()
+	v := c.ViewFor(c.Species[0])
+	beta := v.LookupSpecies(2)
+	if beta.EconUnitsBanked != 0 || beta.EconUnitsProduced != 0 || beta.MI.CurrentLevel != 0 || beta.MI.Code != "MI" {
+		t.Errorf("Beta: want economy and tech cleared: got %d EUs, %d produced, %+v", beta.EconUnitsBanked, beta.EconUnitsProduced, beta.MI)
+	}
+	colony := beta.LookupColony(1)
+	if colony.PopulationUnits != 0 || colony.MiningBase != 0 || colony.ManufacturingBase != 0 || colony.Production != 0 {
+		t.Errorf("Beta colony: want economy cleared: got %d PUs, %d MI base, %d MA base, %d produced",
+			colony.PopulationUnits, colony.MiningBase, colony.ManufacturingBase, colony.Production)
+	}
+	if colony.Inventory != nil || colony.DevelopIUs != nil || colony.Message != 0 || colony.UseOnAmbush != 0 {
+		t.Errorf("Beta colony: want orders and cargo cleared: got %+v", colony)
+	}
+	if colony.Name == "" || colony.Shipyards != 2 || colony.Planet != v.LookupPlanet(1) {
+		t.Errorf("Beta colony: want name, shipyards and planet kept: got %+v", colony)
+	}
+	if p := v.LookupPlanet(1); p.LSN[0] != 1 || p.LSN[1] != 0 || p.LSN[2] != 0 {
+		t.Errorf("planet 1: want only Alpha's LSN: got %v", p.LSN)
+	}
+	// the cluster itself is not changed
+	if c.Species[1].Colonies[0].PopulationUnits != 50 || c.Species[1].EconUnitsBanked != 200 {
+		t.Errorf("cluster: want unchanged")
+	}
+}
+
+func TestViewForKeepsViewer(t *testing.T) {
+	c := newViewTestCluster()
+	v := c.ViewFor(c.Species[0])
+	alpha, orig := v.LookupSpecies(1), c.Species[0]
+	if alpha.EconUnitsBanked != orig.EconUnitsBanked || len(alpha.SystemsScanned) != 1 || len(alpha.SystemsVisited) != 2 {
+		t.Errorf("Alpha: want unchanged: got %+v", alpha)
+	}
+	if alpha.Contacts["Beta"] != v.LookupSpecies(2) {
+		t.Errorf("Alpha contacts: want the Beta in the view: got %v", alpha.Contacts)
+	}
+	got, want := alpha.LookupColony(1), orig.Colonies[0]
+	if got == want {
+		t.Fatalf("Alpha colony: want a copy: got the original")
+	}
+	if got.PopulationUnits != want.PopulationUnits || got.MiningBase != want.MiningBase ||
+		got.ManufacturingBase != want.ManufacturingBase || got.Production != want.Production ||
+		got.Message != want.Message || got.UseOnAmbush != want.UseOnAmbush ||
+		!reflect.DeepEqual(got.Inventory, want.Inventory) || !reflect.DeepEqual(got.DevelopIUs, want.DevelopIUs) {
+		t.Errorf("Alpha colony: want %+v: got %+v", want, got)
+	}
+}
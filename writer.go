@@ -0,0 +1,120 @@
+// fhdata - Far Horizons Data
+//
+// Copyright (c) 2022 Michael D Henderson
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+//
+
+package fhdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+// writeRecord writes data as a record that is size bytes long in the file.
+// The record is truncated or zero-filled to the size.
+func writeRecord(w io.Writer, bo binary.ByteOrder, size int, data interface{}) error {
+	var b bytes.Buffer
+	if err := binary.Write(&b, bo, data); err != nil {
+		return err
+	}
+	buf := b.Bytes()
+	if len(buf) < size {
+		buf = append(buf, make([]byte, size-len(buf))...)
+	}
+	_, err := w.Write(buf[:size])
+	return err
+}
+
+// writeGalaxy writes the galaxy_data to the named file.
+func writeGalaxy(name string, bo binary.ByteOrder, g *galaxy_data) error {
+	var w bytes.Buffer
+	if err := binary.Write(&w, bo, g); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, w.Bytes(), 0644)
+}
+
+func writeNamplas(w io.Writer, namplas []nampla_data, bo binary.ByteOrder, size int) error {
+	for i := range namplas {
+		if err := writeRecord(w, bo, size, &namplas[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePlanets writes the planet count and planet data to the named file.
+func writePlanets(name string, layout *Layout, planets []planet_data) error {
+	var w bytes.Buffer
+	if err := binary.Write(&w, layout.ByteOrder, int32(len(planets))); err != nil {
+		return err
+	}
+	for i := range planets {
+		if err := writeRecord(&w, layout.ByteOrder, layout.PlanetSize, &planets[i]); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(name, w.Bytes(), 0644)
+}
+
+func writeShips(w io.Writer, ships []ship_data, bo binary.ByteOrder, size int) error {
+	for i := range ships {
+		if err := writeRecord(w, bo, size, &ships[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSpecies writes the species data followed by its namplas and ships to the named file.
+// the counts in the species data are updated to match the namplas and ships.
+func writeSpecies(name string, layout *Layout, sp *species_file) error {
+	sp.data.NumNamplas = int32(len(sp.namplas))
+	sp.data.NumShips = int32(len(sp.ships))
+
+	var w bytes.Buffer
+	if err := writeRecord(&w, layout.ByteOrder, layout.SpeciesSize, sp.data); err != nil {
+		return err
+	}
+	if err := writeNamplas(&w, sp.namplas, layout.ByteOrder, layout.NamplaSize); err != nil {
+		return err
+	}
+	if err := writeShips(&w, sp.ships, layout.ByteOrder, layout.ShipSize); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, w.Bytes(), 0644)
+}
+
+// writeStars writes the star count and star data to the named file.
+func writeStars(name string, layout *Layout, stars []star_data) error {
+	var w bytes.Buffer
+	if err := binary.Write(&w, layout.ByteOrder, int32(len(stars))); err != nil {
+		return err
+	}
+	for i := range stars {
+		if err := writeRecord(&w, layout.ByteOrder, layout.StarSize, &stars[i]); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(name, w.Bytes(), 0644)
+}